@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
@@ -14,6 +15,7 @@ import (
 	"github.com/stilln0thing/matiks_leaderboard/internal/config"
 	"github.com/stilln0thing/matiks_leaderboard/internal/database"
 	"github.com/stilln0thing/matiks_leaderboard/internal/handler"
+	"github.com/stilln0thing/matiks_leaderboard/internal/rating"
 	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
 	"github.com/stilln0thing/matiks_leaderboard/internal/service"
 	"github.com/stilln0thing/matiks_leaderboard/internal/simulator"
@@ -41,21 +43,70 @@ func main() {
 	log.Println("Redis connected")
 	// 4. Initialize repositories
 	userRepo := repository.NewUserRepository(db)
+	boardRepo := repository.NewBoardRepository(db)
+	seasonRepo := repository.NewSeasonRepository(db)
+	historyRepo := repository.NewHistoryRepository(db)
+	snapshotRepo := repository.NewSnapshotRepository(db)
+	teamRepo := repository.NewTeamRepository(db)
+	deadLetterRepo := repository.NewDeadLetterRepository(db)
 	cacheRepo := repository.NewCacheRepository(redisClient)
-	// 5. Initialize DB writer worker
-	dbWriter := worker.NewDBWriter(userRepo, 10000, 500, 250*time.Millisecond)
-	// 6. Initialize service
-	leaderboardService := service.NewLeaderboardService(userRepo, cacheRepo, dbWriter.Queue())
+	updateQueue := repository.NewUpdateQueue(redisClient)
+	// 5. Initialize DB writer worker (drains the durable update stream)
+	dbWriter := worker.NewDBWriter(userRepo, updateQueue, deadLetterRepo, cfg.InstanceID, 500, 250*time.Millisecond)
+	// 6. Initialize rating system, version source + service
+	ratingSystem, err := rating.New(cfg.RatingSystem, cfg.EloKFactor, cfg.GlickoTau)
+	if err != nil {
+		log.Fatalf("Rating system: %v", err)
+	}
+	versions, err := service.NewVersionSource(cfg.VersionSource, cacheRepo)
+	if err != nil {
+		log.Fatalf("Version source: %v", err)
+	}
+	leaderboardService := service.NewLeaderboardService(userRepo, boardRepo, cacheRepo, ratingSystem, updateQueue, versions)
+	seasonService := service.NewSeasonService(seasonRepo, cacheRepo, leaderboardService)
+	historyService := service.NewHistoryService(historyRepo, snapshotRepo, cacheRepo, leaderboardService)
+	teamService := service.NewTeamService(teamRepo, userRepo, cacheRepo)
+	deadLetterService := service.NewDeadLetterService(deadLetterRepo, updateQueue)
+	reconcileService := service.NewReconcileService(leaderboardService, 2*time.Second)
+	// Writes made while Redis was down only reached Postgres
+	leaderboardService.OnRedisRecover(func() error {
+		_, err := reconcileService.Resync(context.Background())
+		return err
+	})
+	leaderboardStream := service.NewLeaderboardStream(leaderboardService, 500*time.Millisecond)
 	// 7. Warm cache from DB
 	ctx := context.Background()
+	if err := leaderboardService.SetGlobalTieBreak(ctx, cfg.GlobalTieBreak); err != nil {
+		log.Printf("Warning: Failed to set global tie-break: %v", err)
+	}
 	if err := leaderboardService.WarmCache(ctx); err != nil {
 		log.Printf("Warning: Failed to warm cache: %v", err)
 	}
-	// 8. Initialize handler
-	leaderboardHandler := handler.NewLeaderboardHandler(leaderboardService)
+	if err := teamService.WarmCache(ctx); err != nil {
+		log.Printf("Warning: Failed to warm team cache: %v", err)
+	}
+	// 8. Initialize handlers
+	leaderboardHandler := handler.NewLeaderboardHandler(leaderboardService, historyService)
+	seasonHandler := handler.NewSeasonHandler(seasonService)
+	historyHandler := handler.NewHistoryHandler(historyService)
+	teamHandler := handler.NewTeamHandler(teamService)
+	streamHandler := handler.NewStreamHandler(leaderboardStream)
+	adminHandler := handler.NewAdminHandler(deadLetterService, reconcileService)
 	// 9. Initialize simulator (optional - for demo)
 	scoreUpdater := simulator.NewScoreUpdater(userRepo, leaderboardService, 1*time.Second, 10)
-	// 10. Setup Gin router
+	// 10. Initialize period roller (expires closed daily/weekly/monthly windows)
+	periodRoller := worker.NewPeriodRoller(cacheRepo, leaderboardService, 1*time.Minute)
+	// 11. Initialize rating decayer (lowers ratings of inactive players)
+	ratingDecayer := worker.NewRatingDecayer(leaderboardService,
+		time.Duration(cfg.DecayAfterDays)*24*time.Hour, cfg.DecayPoints, cfg.DecayFloor, 1*time.Hour)
+	// 12. Initialize snapshotter (daily compact board snapshots for ?at= queries)
+	snapshotter := worker.NewSnapshotter(historyService, leaderboardService,
+		time.Duration(cfg.SnapshotEveryHours)*time.Hour, time.Duration(cfg.SnapshotRetentionDays)*24*time.Hour, 10*time.Minute)
+	// 13. Initialize reconciler (repairs Redis <-> Postgres drift)
+	reconciler := worker.NewReconciler(reconcileService, time.Duration(cfg.ReconcileEveryMinutes)*time.Minute)
+	// 14. Initialize season archiver (resumes archive runs cut short by a restart)
+	seasonArchiver := worker.NewSeasonArchiver(seasonService, 1*time.Minute)
+	// 15. Setup Gin router
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(gin.Recovery())
@@ -70,17 +121,35 @@ func main() {
 	}))
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
+		if leaderboardService.Degraded() {
+			c.JSON(http.StatusOK, gin.H{"status": "degraded", "redis": "down"})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 	})
+	// Metrics (expvar JSON, e.g. reconcile drift counters)
+	r.GET("/debug/vars", gin.WrapH(expvar.Handler()))
 	// API routes
 	api := r.Group("/api")
 	leaderboardHandler.RegisterRoutes(api)
+	seasonHandler.RegisterRoutes(api)
+	historyHandler.RegisterRoutes(api)
+	teamHandler.RegisterRoutes(api)
+	streamHandler.RegisterRoutes(api)
+	adminHandler.RegisterRoutes(api)
 	// Create shutdown context
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	// Start background workers
 	go dbWriter.Start(ctx)
 	go scoreUpdater.Start(ctx)
+	go periodRoller.Start(ctx)
+	go ratingDecayer.Start(ctx)
+	go snapshotter.Start(ctx)
+	go seasonArchiver.Start(ctx)
+	go leaderboardService.ListenChanges(ctx)
+	go leaderboardStream.Start(ctx)
+	go reconciler.Start(ctx)
 	// Start HTTP server
 	srv := &http.Server{
 		Addr:    ":" + cfg.Port,
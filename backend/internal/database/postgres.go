@@ -26,8 +26,157 @@ func NewPostgres(databaseURL string) (*sqlx.DB, error) {
         updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
     );
     
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS rating_achieved_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS rating_deviation DOUBLE PRECISION NOT NULL DEFAULT 350;
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS volatility DOUBLE PRECISION NOT NULL DEFAULT 0.06;
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS rating_decayed BOOLEAN NOT NULL DEFAULT FALSE;
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS region VARCHAR(2) NOT NULL DEFAULT '';
+
     CREATE INDEX IF NOT EXISTS idx_users_rating ON users(rating DESC);
     CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
+    CREATE INDEX IF NOT EXISTS idx_users_updated_at ON users(updated_at);
+
+    CREATE TABLE IF NOT EXISTS leaderboards (
+        id VARCHAR(64) PRIMARY KEY,
+        name VARCHAR(255) NOT NULL,
+        rank_mode VARCHAR(16) NOT NULL DEFAULT 'competition',
+        tie_break BOOLEAN NOT NULL DEFAULT FALSE,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+
+    INSERT INTO leaderboards (id, name) VALUES ('global', 'Global') ON CONFLICT (id) DO NOTHING;
+
+    CREATE TABLE IF NOT EXISTS board_ratings (
+        board_id VARCHAR(64) NOT NULL REFERENCES leaderboards(id) ON DELETE CASCADE,
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        rating INTEGER NOT NULL DEFAULT 1000,
+        version BIGINT NOT NULL DEFAULT 0,
+        achieved_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        rating_deviation DOUBLE PRECISION NOT NULL DEFAULT 350,
+        volatility DOUBLE PRECISION NOT NULL DEFAULT 0.06,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (board_id, user_id)
+    );
+
+    ALTER TABLE board_ratings ADD COLUMN IF NOT EXISTS decayed BOOLEAN NOT NULL DEFAULT FALSE;
+
+    CREATE INDEX IF NOT EXISTS idx_board_ratings_rating ON board_ratings(board_id, rating DESC);
+    CREATE INDEX IF NOT EXISTS idx_board_ratings_updated_at ON board_ratings(board_id, updated_at);
+
+    CREATE TABLE IF NOT EXISTS seasons (
+        id SERIAL PRIMARY KEY,
+        board_id VARCHAR(64) NOT NULL REFERENCES leaderboards(id) ON DELETE CASCADE,
+        name VARCHAR(255) NOT NULL,
+        status VARCHAR(16) NOT NULL DEFAULT 'active',
+        reset_factor DOUBLE PRECISION NOT NULL DEFAULT 0,
+        reset_target INTEGER NOT NULL DEFAULT 1000,
+        started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        ended_at TIMESTAMP
+    );
+
+    -- Version of the soft reset, kept so a resumed archive resets with the
+    -- same one, and the lease of the instance running the archive
+    ALTER TABLE seasons ADD COLUMN IF NOT EXISTS reset_version BIGINT NOT NULL DEFAULT 0;
+    ALTER TABLE seasons ADD COLUMN IF NOT EXISTS archive_lease TIMESTAMPTZ;
+
+    -- One running season per board
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_seasons_active ON seasons(board_id) WHERE status = 'active';
+
+    CREATE TABLE IF NOT EXISTS season_standings (
+        season_id INTEGER NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+        position BIGINT NOT NULL,
+        rank BIGINT NOT NULL,
+        user_id INTEGER NOT NULL,
+        username VARCHAR(255) NOT NULL,
+        rating INTEGER NOT NULL,
+        PRIMARY KEY (season_id, position)
+    );
+
+    -- Append-only, one row per applied rating write
+    CREATE TABLE IF NOT EXISTS rating_history (
+        id BIGSERIAL PRIMARY KEY,
+        board_id VARCHAR(64) NOT NULL REFERENCES leaderboards(id) ON DELETE CASCADE,
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        old_rating INTEGER,
+        new_rating INTEGER NOT NULL,
+        version BIGINT NOT NULL,
+        source VARCHAR(32) NOT NULL,
+        recorded_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+
+    -- recorded_at is when the update was made, logged_at when its row was
+    -- written, which a queued or replayed write can do much later. Snapshot
+    -- replays need the latter; old rows are assumed written when made.
+    DO $$
+    BEGIN
+        IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema()
+            AND table_name = 'rating_history' AND column_name = 'logged_at') THEN
+            ALTER TABLE rating_history ADD COLUMN logged_at TIMESTAMPTZ;
+            UPDATE rating_history SET logged_at = recorded_at;
+            ALTER TABLE rating_history ALTER COLUMN logged_at SET DEFAULT CURRENT_TIMESTAMP;
+            ALTER TABLE rating_history ALTER COLUMN logged_at SET NOT NULL;
+        END IF;
+    END $$;
+
+    CREATE INDEX IF NOT EXISTS idx_rating_history_user ON rating_history(board_id, user_id, recorded_at);
+    CREATE INDEX IF NOT EXISTS idx_rating_history_time ON rating_history(board_id, recorded_at);
+    CREATE INDEX IF NOT EXISTS idx_rating_history_logged ON rating_history(board_id, logged_at);
+
+    CREATE TABLE IF NOT EXISTS leaderboard_snapshots (
+        id SERIAL PRIMARY KEY,
+        board_id VARCHAR(64) NOT NULL REFERENCES leaderboards(id) ON DELETE CASCADE,
+        taken_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+
+    CREATE INDEX IF NOT EXISTS idx_leaderboard_snapshots_board ON leaderboard_snapshots(board_id, taken_at);
+
+    -- Both used to be TIMESTAMP, which drops the offset of non-UTC ?at= / from / to
+    -- parameters. Old values were written by UTC servers.
+    DO $$
+    BEGIN
+        IF (SELECT data_type FROM information_schema.columns WHERE table_schema = current_schema()
+            AND table_name = 'rating_history' AND column_name = 'recorded_at') = 'timestamp without time zone' THEN
+            ALTER TABLE rating_history ALTER COLUMN recorded_at TYPE TIMESTAMPTZ USING recorded_at AT TIME ZONE 'UTC';
+        END IF;
+        IF (SELECT data_type FROM information_schema.columns WHERE table_schema = current_schema()
+            AND table_name = 'leaderboard_snapshots' AND column_name = 'taken_at') = 'timestamp without time zone' THEN
+            ALTER TABLE leaderboard_snapshots ALTER COLUMN taken_at TYPE TIMESTAMPTZ USING taken_at AT TIME ZONE 'UTC';
+        END IF;
+    END $$;
+
+    CREATE TABLE IF NOT EXISTS teams (
+        id SERIAL PRIMARY KEY,
+        name VARCHAR(255) UNIQUE NOT NULL,
+        aggregate VARCHAR(16) NOT NULL DEFAULT 'top5_avg',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+
+    -- A player is in at most one team
+    CREATE TABLE IF NOT EXISTS team_members (
+        team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+        user_id INTEGER NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+        joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (team_id, user_id)
+    );
+
+    -- Just user and rating, names and ranks are derived on read
+    CREATE TABLE IF NOT EXISTS snapshot_entries (
+        snapshot_id INTEGER NOT NULL REFERENCES leaderboard_snapshots(id) ON DELETE CASCADE,
+        user_id INTEGER NOT NULL,
+        rating INTEGER NOT NULL,
+        PRIMARY KEY (snapshot_id, user_id)
+    );
+
+    -- Updates the DB writer could not apply, kept for inspection and replay.
+    -- No foreign keys, a missing user or board is a common reason to be here
+    CREATE TABLE IF NOT EXISTS dead_letters (
+        id BIGSERIAL PRIMARY KEY,
+        board_id VARCHAR(64) NOT NULL,
+        user_id INTEGER NOT NULL,
+        payload JSONB NOT NULL,
+        error TEXT NOT NULL,
+        failed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
     `
     
     _, err = db.Exec(schema)
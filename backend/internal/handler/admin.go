@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
+	"github.com/stilln0thing/matiks_leaderboard/internal/service"
+)
+
+type AdminHandler struct {
+	deadLetters *service.DeadLetterService
+	reconcile   *service.ReconcileService
+}
+
+func NewAdminHandler(deadLetters *service.DeadLetterService, reconcile *service.ReconcileService) *AdminHandler {
+	return &AdminHandler{deadLetters: deadLetters, reconcile: reconcile}
+}
+
+func (h *AdminHandler) RegisterRoutes(r *gin.RouterGroup) {
+	admin := r.Group("/admin")
+	admin.GET("/dead-letters", h.GetDeadLetters)
+	admin.POST("/dead-letters/replay", h.ReplayDeadLetters)
+	admin.POST("/dead-letters/:id/replay", h.ReplayDeadLetter)
+	admin.DELETE("/dead-letters/:id", h.DiscardDeadLetter)
+	admin.GET("/reconcile", h.GetReconcile)
+	admin.POST("/reconcile", h.StartReconcile)
+}
+
+// GET /api/admin/dead-letters?limit=50&after=0
+func (h *AdminHandler) GetDeadLetters(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	after, _ := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	if limit > 500 {
+		limit = 500
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	letters, total, err := h.deadLetters.List(c.Request.Context(), after, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resp := gin.H{"dead_letters": letters, "total": total}
+	// Pass as ?after= for the next page
+	if len(letters) == limit {
+		resp["next_after"] = letters[len(letters)-1].ID
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// POST /api/admin/dead-letters/:id/replay
+func (h *AdminHandler) ReplayDeadLetter(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dead letter ID"})
+		return
+	}
+	err = h.deadLetters.Replay(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, repository.ErrDeadLetterNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "requeued", "id": id})
+}
+
+// POST /api/admin/dead-letters/replay
+func (h *AdminHandler) ReplayDeadLetters(c *gin.Context) {
+	n, err := h.deadLetters.ReplayAll(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "replayed": n})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "requeued", "replayed": n})
+}
+
+// DELETE /api/admin/dead-letters/:id
+func (h *AdminHandler) DiscardDeadLetter(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dead letter ID"})
+		return
+	}
+	err = h.deadLetters.Discard(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, repository.ErrDeadLetterNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "discarded", "id": id})
+}
+
+// GET /api/admin/reconcile
+func (h *AdminHandler) GetReconcile(c *gin.Context) {
+	running, last := h.reconcile.Status()
+	c.JSON(http.StatusOK, gin.H{"running": running, "last": last})
+}
+
+// POST /api/admin/reconcile
+func (h *AdminHandler) StartReconcile(c *gin.Context) {
+	err := h.reconcile.Start()
+	if errors.Is(err, service.ErrReconcileRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "started"})
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stilln0thing/matiks_leaderboard/internal/service"
+)
+
+type HistoryHandler struct {
+	service *service.HistoryService
+}
+
+func NewHistoryHandler(service *service.HistoryService) *HistoryHandler {
+	return &HistoryHandler{service: service}
+}
+
+func (h *HistoryHandler) RegisterRoutes(r *gin.RouterGroup) {
+	for _, g := range []*gin.RouterGroup{r, r.Group("/leaderboards/:board")} {
+		g.GET("/user/:id/history", h.GetHistory)
+	}
+}
+
+// parseTime - Optional RFC 3339 query parameter, zero when missing
+func parseTime(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("'" + name + "' must be an RFC 3339 timestamp")
+	}
+	return t, nil
+}
+
+// GET /api/user/:id/history?from=2026-10-01T00:00:00Z&to=2026-10-17T00:00:00Z
+func (h *HistoryHandler) GetHistory(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+	from, err := parseTime(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTime(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	history, err := h.service.GetHistory(c.Request.Context(), boardID(c), id, from, to)
+	switch {
+	case errors.Is(err, service.ErrInvalidRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrBoardNotFound) || errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
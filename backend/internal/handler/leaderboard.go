@@ -1,32 +1,143 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
 	"github.com/stilln0thing/matiks_leaderboard/internal/service"
 )
 
 type LeaderboardHandler struct {
 	service *service.LeaderboardService
+	history *service.HistoryService // Serves ?at= reads
 }
 
-func NewLeaderboardHandler(service *service.LeaderboardService) *LeaderboardHandler {
-	return &LeaderboardHandler{service: service}
+func NewLeaderboardHandler(service *service.LeaderboardService, history *service.HistoryService) *LeaderboardHandler {
+	return &LeaderboardHandler{service: service, history: history}
 }
 
 func (h *LeaderboardHandler) RegisterRoutes(r *gin.RouterGroup) {
+	// Legacy routes operate on the global board
+	h.registerBoardRoutes(r)
+	r.PUT("/user/:id/region", h.SetRegion)
+	r.GET("/leaderboards", h.GetBoards)
+	r.POST("/leaderboards", h.CreateBoard)
+	r.PUT("/leaderboards/:board", h.UpdateBoard)
+	h.registerBoardRoutes(r.Group("/leaderboards/:board"))
+}
+
+func (h *LeaderboardHandler) registerBoardRoutes(r *gin.RouterGroup) {
 	r.GET("/leaderboard", h.GetLeaderboard)
 	r.GET("/search", h.SearchUsers)
 	r.GET("/user/:id/rank", h.GetUserRank)
+	r.GET("/user/:id/around", h.GetAroundUser)
+	r.GET("/movers", h.GetMovers)
 	r.POST("/rating", h.UpdateRating)
+	r.POST("/rating/delta", h.UpdateRatingBy)
+	r.POST("/rating/batch", h.UpdateRatings)
+	r.POST("/matches", h.ReportMatch)
+}
+
+// boardID - Board from the path, global board for legacy routes
+func boardID(c *gin.Context) string {
+	if board := c.Param("board"); board != "" {
+		return board
+	}
+	return models.DefaultBoard
+}
+
+// GET /api/leaderboards
+func (h *LeaderboardHandler) GetBoards(c *gin.Context) {
+	boards, err := h.service.GetBoards(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"leaderboards": boards})
 }
 
-// GET /api/leaderboard?limit=50&offset=0
+type CreateBoardRequest struct {
+	ID       string `json:"id" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	RankMode string `json:"rank_mode"` // competition (default), dense, ordinal
+	TieBreak bool   `json:"tie_break"` // earliest to reach a rating ranks first
+}
+
+type UpdateBoardRequest struct {
+	Name     string `json:"name" binding:"required"`
+	RankMode string `json:"rank_mode" binding:"required"`
+}
+
+// POST /api/leaderboards
+func (h *LeaderboardHandler) CreateBoard(c *gin.Context) {
+	var req CreateBoardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	mode, err := models.ParseRankMode(req.RankMode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	board, err := h.service.CreateBoard(c.Request.Context(), req.ID, req.Name, mode, req.TieBreak)
+	switch {
+	case errors.Is(err, service.ErrInvalidBoard):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrBoardExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, board)
+}
+
+// PUT /api/leaderboards/:board
+func (h *LeaderboardHandler) UpdateBoard(c *gin.Context) {
+	var req UpdateBoardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	mode, err := models.ParseRankMode(req.RankMode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	board, err := h.service.UpdateBoard(c.Request.Context(), c.Param("board"), req.Name, mode)
+	if errors.Is(err, service.ErrBoardNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, board)
+}
+
+// GET /api/leaderboard?limit=50&offset=0&period=weekly
+// GET /api/leaderboard?limit=50&cursor=<next_cursor>
+// GET /api/leaderboard?limit=50&offset=0&at=2026-10-01T00:00:00Z
+// GET /api/leaderboard?limit=50&region=IN
 func (h *LeaderboardHandler) GetLeaderboard(c *gin.Context) {
 	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
 	offset, _ := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+	period, err := models.ParsePeriod(c.Query("period"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	// Clamp limit
 	if limit > 100 {
 		limit = 100
@@ -34,8 +145,79 @@ func (h *LeaderboardHandler) GetLeaderboard(c *gin.Context) {
 	if limit < 1 {
 		limit = 50
 	}
-	users, total, err := h.service.GetLeaderboard(c.Request.Context(), limit, offset)
+	if c.Query("at") != "" {
+		h.getLeaderboardAt(c, period, limit, offset)
+		return
+	}
+	region := strings.ToUpper(c.Query("region"))
+	var page *models.Page
+	var total int64
+	cursorParam := c.Query("cursor")
+	if cursorParam != "" {
+		cursor, cerr := models.DecodeCursor(cursorParam)
+		if cerr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": cerr.Error()})
+			return
+		}
+		page, total, err = h.service.GetLeaderboardAfter(c.Request.Context(), boardID(c), period, region, cursor, limit)
+	} else {
+		page, total, err = h.service.GetLeaderboard(c.Request.Context(), boardID(c), period, region, limit, offset)
+	}
+	switch {
+	case errors.Is(err, service.ErrInvalidRegion) || errors.Is(err, service.ErrRegionUnsupported):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrBoardNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrDegraded):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resp := gin.H{
+		"users":       page.Users,
+		"total":       total,
+		"limit":       limit,
+		"period":      period,
+		"next_cursor": page.NextCursor,
+		"prev_cursor": page.PrevCursor,
+	}
+	// Offset only means something in offset mode
+	if cursorParam == "" {
+		resp["offset"] = offset
+	}
+	if region != "" {
+		resp["region"] = region
+	}
+	if page.Degraded {
+		resp["degraded"] = true
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// getLeaderboardAt - Historical page, rebuilt from snapshots and history
+func (h *LeaderboardHandler) getLeaderboardAt(c *gin.Context, period models.Period, limit, offset int64) {
+	at, err := parseTime(c, "at")
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if period != models.PeriodAllTime || c.Query("cursor") != "" || c.Query("region") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'at' only supports the alltime period with offset paging and no region"})
+		return
+	}
+	users, total, err := h.history.GetLeaderboardAt(c.Request.Context(), boardID(c), at, limit, offset)
+	switch {
+	case errors.Is(err, service.ErrFutureTime) || errors.Is(err, service.ErrNoSnapshot):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrBoardNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -44,6 +226,8 @@ func (h *LeaderboardHandler) GetLeaderboard(c *gin.Context) {
 		"total":  total,
 		"limit":  limit,
 		"offset": offset,
+		"period": period,
+		"at":     at,
 	})
 }
 
@@ -54,7 +238,11 @@ func (h *LeaderboardHandler) SearchUsers(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "query 'q' is required"})
 		return
 	}
-	users, err := h.service.SearchUsers(c.Request.Context(), query)
+	users, err := h.service.SearchUsers(c.Request.Context(), boardID(c), query)
+	if errors.Is(err, service.ErrBoardNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -66,13 +254,22 @@ func (h *LeaderboardHandler) SearchUsers(c *gin.Context) {
 }
 
 // GET /api/user/:id/rank
+// GET /api/user/:id/rank?at=2026-10-11T00:00:00Z
 func (h *LeaderboardHandler) GetUserRank(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
 		return
 	}
-	user, err := h.service.GetUserRank(c.Request.Context(), id)
+	if c.Query("at") != "" {
+		h.getUserRankAt(c, id)
+		return
+	}
+	user, err := h.service.GetUserRank(c.Request.Context(), boardID(c), id)
+	if errors.Is(err, service.ErrBoardNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 		return
@@ -80,9 +277,130 @@ func (h *LeaderboardHandler) GetUserRank(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+// getUserRankAt - Historical rank, rebuilt from snapshots and history
+func (h *LeaderboardHandler) getUserRankAt(c *gin.Context, id int64) {
+	at, err := parseTime(c, "at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := h.history.GetUserRankAt(c.Request.Context(), boardID(c), id, at)
+	switch {
+	case errors.Is(err, service.ErrFutureTime) || errors.Is(err, service.ErrNoSnapshot):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrBoardNotFound) || errors.Is(err, repository.ErrNotRanked):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// GET /api/user/:id/around?radius=5
+func (h *LeaderboardHandler) GetAroundUser(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+	radius, _ := strconv.ParseInt(c.DefaultQuery("radius", "5"), 10, 64)
+	// Clamp radius
+	if radius > 50 {
+		radius = 50
+	}
+	if radius < 1 {
+		radius = 5
+	}
+	users, err := h.service.GetAroundUser(c.Request.Context(), boardID(c), id, radius)
+	if errors.Is(err, service.ErrBoardNotFound) || errors.Is(err, repository.ErrUserNotCached) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"users":  users,
+		"radius": radius,
+	})
+}
+
+// GET /api/movers?window=24h&direction=up&limit=10
+func (h *LeaderboardHandler) GetMovers(c *gin.Context) {
+	window, err := time.ParseDuration(c.DefaultQuery("window", "24h"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid window"})
+		return
+	}
+	direction := c.DefaultQuery("direction", "up")
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "10"), 10, 64)
+	// Clamp limit
+	if limit > 50 {
+		limit = 50
+	}
+	if limit < 1 {
+		limit = 10
+	}
+	movers, err := h.service.GetMovers(c.Request.Context(), boardID(c), window, direction, limit)
+	switch {
+	case errors.Is(err, service.ErrInvalidWindow) || errors.Is(err, service.ErrInvalidDirection):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrBoardNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"users":     movers,
+		"window":    window.String(),
+		"direction": direction,
+	})
+}
+
+type SetRegionRequest struct {
+	Region string `json:"region"` // two letter country code, empty clears
+}
+
+// PUT /api/user/:id/region
+func (h *LeaderboardHandler) SetRegion(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+	var req SetRegionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	region := strings.ToUpper(req.Region)
+	err = h.service.SetRegion(c.Request.Context(), id, region)
+	switch {
+	case errors.Is(err, service.ErrInvalidRegion):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "updated", "region": region})
+}
+
 type UpdateRatingRequest struct {
 	UserID int64 `json:"user_id" binding:"required"`
 	Rating int   `json:"rating" binding:"required,min=100,max=5000"`
+	// Optional, only apply while this version is stored (0: not rated yet)
+	ExpectedVersion *int64 `json:"expected_version"`
 }
 
 // POST /api/rating
@@ -92,10 +410,144 @@ func (h *LeaderboardHandler) UpdateRating(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	err := h.service.UpdateRating(c.Request.Context(), req.UserID, req.Rating)
+	state, degraded, err := h.service.UpdateRating(c.Request.Context(), boardID(c), req.UserID, req.Rating, req.ExpectedVersion)
+	switch {
+	case errors.Is(err, service.ErrBoardNotFound) || errors.Is(err, service.ErrUserNotFound) ||
+		errors.Is(err, repository.ErrUserNotCached):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrVersionMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "rating": state.Rating, "version": state.Version})
+		return
+	case errors.Is(err, repository.ErrStaleUpdate):
+		// A newer rating is stored, nothing changed
+		c.JSON(http.StatusOK, gin.H{"status": "stale", "rating": state.Rating, "version": state.Version})
+		return
+	case errors.Is(err, service.ErrDegraded):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resp := gin.H{"status": "updated", "rating": state.Rating, "version": state.Version}
+	// Written to Postgres only, Redis catches up after it is back
+	if degraded {
+		resp["degraded"] = true
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+type BatchRatingEntry struct {
+	UserID int64 `json:"user_id"`
+	Rating int   `json:"rating"`
+}
+
+type BatchRatingRequest struct {
+	Updates []BatchRatingEntry `json:"updates" binding:"required,min=1"`
+}
+
+// POST /api/rating/batch
+func (h *LeaderboardHandler) UpdateRatings(c *gin.Context) {
+	var req BatchRatingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Updates) > service.MaxBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d updates per batch", service.MaxBatchSize)})
+		return
+	}
+	entries := make([]models.RatingUpdate, len(req.Updates))
+	for i, u := range req.Updates {
+		entries[i] = models.RatingUpdate{UserID: u.UserID, Rating: u.Rating}
+	}
+	results, err := h.service.UpdateRatings(c.Request.Context(), boardID(c), entries)
+	if errors.Is(err, service.ErrBoardNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrDegraded) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "updated"})
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+type DeltaRatingRequest struct {
+	UserID int64 `json:"user_id" binding:"required"`
+	Delta  int   `json:"delta" binding:"required,min=-4900,max=4900"`
+}
+
+// POST /api/rating/delta
+func (h *LeaderboardHandler) UpdateRatingBy(c *gin.Context) {
+	var req DeltaRatingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rating, version, err := h.service.UpdateRatingBy(c.Request.Context(), boardID(c), req.UserID, req.Delta)
+	if errors.Is(err, service.ErrBoardNotFound) || errors.Is(err, repository.ErrUserNotCached) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repository.ErrStaleUpdate) {
+		// The delta was not added, rating and version are the stored ones
+		c.JSON(http.StatusOK, gin.H{"status": "stale", "rating": rating, "version": version})
+		return
+	}
+	if errors.Is(err, service.ErrDegraded) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "updated", "rating": rating, "version": version})
+}
+
+type MatchTeamRequest struct {
+	Players []int64 `json:"players" binding:"required,min=1"`
+	Outcome string  `json:"outcome" binding:"required,oneof=win loss draw"`
+}
+
+type ReportMatchRequest struct {
+	Teams []MatchTeamRequest `json:"teams" binding:"required,len=2,dive"`
+}
+
+// POST /api/matches
+func (h *LeaderboardHandler) ReportMatch(c *gin.Context) {
+	var req ReportMatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	teams := make([]models.MatchTeam, len(req.Teams))
+	for i, t := range req.Teams {
+		teams[i] = models.MatchTeam{Players: t.Players, Outcome: models.Outcome(t.Outcome)}
+	}
+	results, err := h.service.ReportMatch(c.Request.Context(), boardID(c), teams)
+	switch {
+	case errors.Is(err, service.ErrInvalidMatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrBoardNotFound) || errors.Is(err, repository.ErrUserNotCached):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrMatchConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrDegraded):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
 }
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
+	"github.com/stilln0thing/matiks_leaderboard/internal/service"
+)
+
+type SeasonHandler struct {
+	service *service.SeasonService
+}
+
+func NewSeasonHandler(service *service.SeasonService) *SeasonHandler {
+	return &SeasonHandler{service: service}
+}
+
+func (h *SeasonHandler) RegisterRoutes(r *gin.RouterGroup) {
+	for _, g := range []*gin.RouterGroup{r, r.Group("/leaderboards/:board")} {
+		g.GET("/seasons", h.GetSeasons)
+		g.POST("/seasons", h.StartSeason)
+	}
+	r.POST("/seasons/:id/end", h.EndSeason)
+	r.GET("/seasons/:id/leaderboard", h.GetStandings)
+}
+
+// GET /api/seasons
+func (h *SeasonHandler) GetSeasons(c *gin.Context) {
+	seasons, err := h.service.GetSeasons(c.Request.Context(), boardID(c))
+	if errors.Is(err, service.ErrBoardNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"seasons": seasons})
+}
+
+type StartSeasonRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// POST /api/seasons
+func (h *SeasonHandler) StartSeason(c *gin.Context) {
+	var req StartSeasonRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	season, err := h.service.StartSeason(c.Request.Context(), boardID(c), req.Name)
+	switch {
+	case errors.Is(err, service.ErrBoardNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrSeasonActive):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, season)
+}
+
+type EndSeasonRequest struct {
+	ResetFactor float64 `json:"reset_factor"` // 0 = keep ratings, 1 = everyone back to target
+	ResetTarget *int    `json:"reset_target"` // defaults to 1000
+}
+
+// POST /api/seasons/:id/end
+func (h *SeasonHandler) EndSeason(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid season ID"})
+		return
+	}
+	var req EndSeasonRequest
+	// Empty body ends the season without a reset
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	target := models.DefaultRating
+	if req.ResetTarget != nil {
+		target = *req.ResetTarget
+	}
+	season, err := h.service.EndSeason(c.Request.Context(), id, req.ResetFactor, target)
+	switch {
+	case errors.Is(err, service.ErrInvalidReset):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrSeasonNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrSeasonNotActive):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Archiving runs in the background, poll GET /api/seasons for status
+	c.JSON(http.StatusAccepted, season)
+}
+
+// GET /api/seasons/:id/leaderboard?limit=50&offset=0
+// GET /api/seasons/:id/leaderboard?limit=50&cursor=<next_cursor>
+func (h *SeasonHandler) GetStandings(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid season ID"})
+		return
+	}
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	offset, _ := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+	// Clamp limit
+	if limit > 100 {
+		limit = 100
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	var cursor *models.Cursor
+	cursorParam := c.Query("cursor")
+	if cursorParam != "" {
+		decoded, err := models.DecodeCursor(cursorParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		cursor = &decoded
+	}
+	page, total, err := h.service.GetStandings(c.Request.Context(), id, cursor, limit, offset)
+	switch {
+	case errors.Is(err, models.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrSeasonNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resp := gin.H{
+		"users":       page.Users,
+		"total":       total,
+		"limit":       limit,
+		"next_cursor": page.NextCursor,
+		"prev_cursor": page.PrevCursor,
+	}
+	if cursorParam == "" {
+		resp["offset"] = offset
+	}
+	c.JSON(http.StatusOK, resp)
+}
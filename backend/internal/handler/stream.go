@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+	"github.com/stilln0thing/matiks_leaderboard/internal/service"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	// Comment line that keeps proxies from closing an idle SSE stream
+	sseKeepAlive = 15 * time.Second
+	sseRetry     = 3000 // Reconnect delay suggested to clients, in ms
+)
+
+// CORS allows every origin, so does the upgrade
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+type StreamHandler struct {
+	stream *service.LeaderboardStream
+}
+
+func NewStreamHandler(stream *service.LeaderboardStream) *StreamHandler {
+	return &StreamHandler{stream: stream}
+}
+
+func (h *StreamHandler) RegisterRoutes(r *gin.RouterGroup) {
+	for _, g := range []*gin.RouterGroup{r, r.Group("/leaderboards/:board")} {
+		g.GET("/leaderboard/ws", h.StreamLeaderboard)
+		g.GET("/user/:id/rank/stream", h.StreamUserRank)
+	}
+}
+
+// windowRequest - Client message moving its window
+type windowRequest struct {
+	Offset int64 `json:"offset"`
+	Limit  int64 `json:"limit"`
+}
+
+// clampWindow - Same limits as the paginated leaderboard
+func clampWindow(offset, limit int64) (int64, int64) {
+	if limit > service.MaxStreamWindow {
+		limit = service.MaxStreamWindow
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return offset, limit
+}
+
+// GET /api/leaderboard/ws?limit=50&offset=0
+// Sends a snapshot, then one diff per tick while the window changes.
+// Send {"offset":1000,"limit":50} to move the window.
+func (h *StreamHandler) StreamLeaderboard(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	offset, _ := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+	offset, limit = clampWindow(offset, limit)
+	board := boardID(c)
+	ctx := c.Request.Context()
+	// Subscribe before upgrading so errors are still plain HTTP
+	sub, snapshot, err := h.stream.Subscribe(ctx, board, offset, limit)
+	switch {
+	case errors.Is(err, service.ErrBoardNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade already answered the request
+		h.stream.Unsubscribe(sub)
+		return
+	}
+	defer conn.Close()
+	defer func() { h.stream.Unsubscribe(sub) }()
+
+	requests := make(chan windowRequest)
+	done := make(chan struct{})
+	defer close(done)
+	go readWindowRequests(conn, requests, done)
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	if writeJSON(conn, snapshot) != nil {
+		return
+	}
+	for {
+		select {
+		case event := <-sub.Events():
+			if writeJSON(conn, event) != nil {
+				return
+			}
+		case req, ok := <-requests:
+			if !ok {
+				return
+			}
+			offset, limit := clampWindow(req.Offset, req.Limit)
+			next, snapshot, err := h.stream.Subscribe(ctx, board, offset, limit)
+			if err != nil {
+				// Keep streaming the current window
+				if writeJSON(conn, gin.H{"type": "error", "error": err.Error()}) != nil {
+					return
+				}
+				continue
+			}
+			h.stream.Unsubscribe(sub)
+			sub = next
+			if writeJSON(conn, snapshot) != nil {
+				return
+			}
+		case <-ping.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)) != nil {
+				return
+			}
+		}
+	}
+}
+
+// rankEventID - Event ID derived from the state itself, so a client resuming
+// with the ID of what it already shows gets nothing until the next change
+func rankEventID(u models.RankedUser) string {
+	return fmt.Sprintf("%d-%d", u.Rank, u.Rating)
+}
+
+// GET /api/user/:id/rank/stream
+// Server-Sent Events, a "rank" event whenever the user's rank or rating
+// changes, including when someone overtakes them. On reconnect the current
+// state is sent unless Last-Event-ID says the client already has it.
+func (h *StreamHandler) StreamUserRank(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+	ctx := c.Request.Context()
+	sub, current, err := h.stream.SubscribeRank(ctx, boardID(c), id)
+	if errors.Is(err, service.ErrBoardNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	defer h.stream.UnsubscribeRank(sub)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // nginx would buffer the stream
+	c.Status(http.StatusOK)
+	send := func(u models.RankedUser) {
+		c.Render(-1, sse.Event{Id: rankEventID(u), Event: "rank", Retry: sseRetry, Data: u})
+		c.Writer.Flush()
+	}
+	if c.GetHeader("Last-Event-ID") != rankEventID(*current) {
+		send(*current)
+	} else {
+		c.Writer.WriteHeaderNow()
+		c.Writer.Flush()
+	}
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case u := <-sub.Events():
+			send(u)
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// readWindowRequests - Read client messages until the connection closes
+func readWindowRequests(conn *websocket.Conn, requests chan<- windowRequest, done <-chan struct{}) {
+	defer close(requests)
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		var req windowRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		select {
+		case requests <- req:
+		case <-done:
+			return
+		}
+	}
+}
+
+func writeJSON(conn *websocket.Conn, v interface{}) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteJSON(v)
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
+	"github.com/stilln0thing/matiks_leaderboard/internal/service"
+)
+
+type TeamHandler struct {
+	service *service.TeamService
+}
+
+func NewTeamHandler(service *service.TeamService) *TeamHandler {
+	return &TeamHandler{service: service}
+}
+
+func (h *TeamHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("/teams", h.GetTeams)
+	r.POST("/teams", h.CreateTeam)
+	r.GET("/teams/leaderboard", h.GetTeamLeaderboard)
+	r.PUT("/teams/:id", h.UpdateTeam)
+	r.POST("/teams/:id/join", h.JoinTeam)
+	r.POST("/teams/:id/leave", h.LeaveTeam)
+}
+
+// GET /api/teams
+func (h *TeamHandler) GetTeams(c *gin.Context) {
+	teams, err := h.service.GetTeams(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"teams": teams})
+}
+
+type CreateTeamRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Aggregate string `json:"aggregate"` // top5_avg (default), sum, median
+}
+
+// POST /api/teams
+func (h *TeamHandler) CreateTeam(c *gin.Context) {
+	var req CreateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	aggregate, err := models.ParseTeamAggregate(req.Aggregate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	team, err := h.service.CreateTeam(c.Request.Context(), req.Name, aggregate)
+	switch {
+	case errors.Is(err, service.ErrInvalidTeam):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrTeamExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, team)
+}
+
+type UpdateTeamRequest struct {
+	Aggregate string `json:"aggregate" binding:"required"`
+}
+
+// PUT /api/teams/:id
+func (h *TeamHandler) UpdateTeam(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team ID"})
+		return
+	}
+	var req UpdateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	aggregate, err := models.ParseTeamAggregate(req.Aggregate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	team, err := h.service.UpdateAggregate(c.Request.Context(), id, aggregate)
+	if errors.Is(err, repository.ErrTeamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, team)
+}
+
+type TeamMemberRequest struct {
+	UserID int64 `json:"user_id" binding:"required"`
+}
+
+// POST /api/teams/:id/join
+func (h *TeamHandler) JoinTeam(c *gin.Context) {
+	id, req, ok := h.bindMember(c)
+	if !ok {
+		return
+	}
+	err := h.service.JoinTeam(c.Request.Context(), id, req.UserID)
+	switch {
+	case errors.Is(err, repository.ErrTeamNotFound) || errors.Is(err, service.ErrUserNotFound) ||
+		errors.Is(err, repository.ErrUserNotCached):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrAlreadyInTeam) || errors.Is(err, service.ErrTeamFull):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "joined"})
+}
+
+// POST /api/teams/:id/leave
+func (h *TeamHandler) LeaveTeam(c *gin.Context) {
+	id, req, ok := h.bindMember(c)
+	if !ok {
+		return
+	}
+	err := h.service.LeaveTeam(c.Request.Context(), id, req.UserID)
+	if errors.Is(err, service.ErrNotInTeam) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "left"})
+}
+
+// bindMember - Team ID from the path and user from the body
+func (h *TeamHandler) bindMember(c *gin.Context) (int64, TeamMemberRequest, bool) {
+	var req TeamMemberRequest
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team ID"})
+		return 0, req, false
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return 0, req, false
+	}
+	return id, req, true
+}
+
+// GET /api/teams/leaderboard?limit=50&offset=0
+func (h *TeamHandler) GetTeamLeaderboard(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	offset, _ := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+	// Clamp limit
+	if limit > 100 {
+		limit = 100
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	teams, total, err := h.service.GetTeamLeaderboard(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"teams":  teams,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
@@ -0,0 +1,18 @@
+package models
+
+// Per-item outcome of a batch rating update
+const (
+    BatchApplied     = "applied"
+    BatchStale       = "stale"        // a newer version was already applied
+    BatchUnknownUser = "unknown_user" // user is not on the board's cache
+    BatchRejected    = "rejected"     // failed validation, see Error
+)
+
+// BatchItemResult is the result of one entry of a batch update
+type BatchItemResult struct {
+    UserID  int64  `json:"user_id"`
+    Rating  int    `json:"rating"`
+    Status  string `json:"status"`
+    Version int64  `json:"version,omitempty"` // assigned version, when applied
+    Error   string `json:"error,omitempty"`
+}
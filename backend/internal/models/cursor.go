@@ -0,0 +1,56 @@
+package models
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "math"
+    "strconv"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks a position on a board by the last seen score + member,
+// so pages stay stable while ratings change underneath them
+type Cursor struct {
+    Score  string `json:"s"` // raw sorted set score, exact for tie-break boards
+    Member string `json:"m"`
+    Prev   bool   `json:"p,omitempty"` // page backwards from this entry
+}
+
+// Encode - Opaque string form handed to clients
+func (c Cursor) Encode() string {
+    data, _ := json.Marshal(c)
+    return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor - Parse a cursor produced by Encode
+func DecodeCursor(s string) (Cursor, error) {
+    var c Cursor
+    data, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        return c, ErrInvalidCursor
+    }
+    if err := json.Unmarshal(data, &c); err != nil {
+        return c, ErrInvalidCursor
+    }
+    // Both end up in Redis commands, only accept what Encode produces
+    // ParseFloat also takes NaN and Inf, which are no valid score bounds
+    score, err := strconv.ParseFloat(c.Score, 64)
+    if err != nil || math.IsNaN(score) || math.IsInf(score, 0) {
+        return c, ErrInvalidCursor
+    }
+    if _, err := strconv.ParseInt(c.Member, 10, 64); err != nil {
+        return c, ErrInvalidCursor
+    }
+    return c, nil
+}
+
+// Page is one slice of a board with cursors to its neighbours
+type Page struct {
+    Users      []RankedUser `json:"users"`
+    NextCursor string       `json:"next_cursor,omitempty"`
+    PrevCursor string       `json:"prev_cursor,omitempty"`
+    // Ranked by Postgres while Redis is down
+    Degraded   bool         `json:"-"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// DeadLetter is an update the DB writer gave up on
+type DeadLetter struct {
+    ID       int64        `db:"id" json:"id"`
+    BoardID  string       `db:"board_id" json:"board_id"`
+    UserID   int64        `db:"user_id" json:"user_id"`
+    Payload  []byte       `db:"payload" json:"-"` // JSON of Update
+    Update   RatingUpdate `db:"-" json:"update"`
+    Error    string       `db:"error" json:"error"`
+    FailedAt time.Time    `db:"failed_at" json:"failed_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Source of a rating change, recorded in rating_history
+const (
+    SourceUpdate      = "update"       // POST /rating
+    SourceDelta       = "delta"        // POST /rating/delta
+    SourceBatch       = "batch"        // POST /rating/batch
+    SourceMatch       = "match"        // POST /matches
+    SourceDecay       = "decay"        // inactivity decay
+    SourceSeasonReset = "season_reset" // soft reset at the end of a season
+    SourceReconcile   = "reconcile"    // Redis rating the DB writer never stored
+)
+
+// RatingChange is one row of a user's rating history
+type RatingChange struct {
+    OldRating  *int      `db:"old_rating" json:"old_rating"` // nil for the first rating on a board
+    NewRating  int       `db:"new_rating" json:"rating"`
+    Version    int64     `db:"version" json:"version"`
+    Source     string    `db:"source" json:"source"`
+    RecordedAt time.Time `db:"recorded_at" json:"at"`
+}
+
+// RatingHistory is the rating series of a user on one board
+type RatingHistory struct {
+    UserID     int64          `json:"user_id"`
+    BoardID    string         `json:"board_id"`
+    From       time.Time      `json:"from"`
+    To         time.Time      `json:"to"`
+    Changes    []RatingChange `json:"history"`
+    PeakRating int            `json:"peak_rating"` // all-time, not just the requested range
+    PeakRank   int64          `json:"peak_rank"`   // competition rank, 0 if unknown
+}
+
+// Mover is a player ranked by rating change over a recent window
+type Mover struct {
+    ID       int64  `json:"id"`
+    Username string `json:"username"`
+    Rating   int    `json:"rating"` // current rating
+    Change   int    `json:"change"` // summed change within the window
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+    "fmt"
+    "time"
+)
+
+// DefaultBoard is the original global ladder, stored in users.rating
+const DefaultBoard = "global"
+
+// RankMode decides how tied ratings are ranked
+type RankMode string
+
+const (
+    RankCompetition RankMode = "competition" // 1224
+    RankDense       RankMode = "dense"       // 1223
+    RankOrdinal     RankMode = "ordinal"     // 1234, ties broken by sorted set order
+)
+
+// ParseRankMode - Empty string means competition
+func ParseRankMode(s string) (RankMode, error) {
+    switch RankMode(s) {
+    case "":
+        return RankCompetition, nil
+    case RankCompetition, RankDense, RankOrdinal:
+        return RankMode(s), nil
+    }
+    return "", fmt.Errorf("invalid rank mode %q", s)
+}
+
+// Leaderboard represents a named ladder with its own sorted set
+type Leaderboard struct {
+    ID        string    `db:"id" json:"id"`
+    Name      string    `db:"name" json:"name"`
+    RankMode  RankMode  `db:"rank_mode" json:"rank_mode"`
+    // Equal ratings are ordered by who reached the rating first
+    TieBreak  bool      `db:"tie_break" json:"tie_break"`
+    CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,48 @@
+package models
+
+// Allowed rating range, matches the POST /api/rating validation
+const (
+    MinRating = 100
+    MaxRating = 5000
+)
+
+// Starting point for players new to a board
+const (
+    DefaultRating     = 1000
+    DefaultDeviation  = 350.0
+    DefaultVolatility = 0.06
+)
+
+// Outcome of a match from one team's point of view
+type Outcome string
+
+const (
+    OutcomeWin  Outcome = "win"
+    OutcomeLoss Outcome = "loss"
+    OutcomeDraw Outcome = "draw"
+)
+
+// MatchTeam is one side of a match, a single player for 1v1
+type MatchTeam struct {
+    Players []int64 `json:"players"`
+    Outcome Outcome `json:"outcome"`
+}
+
+// PlayerState is everything a rating system needs about one player
+type PlayerState struct {
+    UserID     int64
+    Rating     int
+    Version    int64
+    Deviation  float64
+    Volatility float64
+}
+
+// MatchResult is the rating change of one player
+type MatchResult struct {
+    UserID    int64   `json:"user_id"`
+    OldRating int     `json:"old_rating"`
+    NewRating int     `json:"new_rating"`
+    Delta     int     `json:"delta"`
+    Deviation float64 `json:"deviation,omitempty"`
+    Version   int64   `json:"version"` // shared by every player of the match
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+    "fmt"
+    "time"
+)
+
+// Period selects the time window of a leaderboard
+type Period string
+
+const (
+    PeriodAllTime Period = "alltime"
+    PeriodDaily   Period = "daily"
+    PeriodWeekly  Period = "weekly"
+    PeriodMonthly Period = "monthly"
+)
+
+// WindowedPeriods are fed on every rating update
+var WindowedPeriods = []Period{PeriodDaily, PeriodWeekly, PeriodMonthly}
+
+// ParsePeriod - Empty string means all-time
+func ParsePeriod(s string) (Period, error) {
+    switch Period(s) {
+    case "", PeriodAllTime:
+        return PeriodAllTime, nil
+    case PeriodDaily, PeriodWeekly, PeriodMonthly:
+        return Period(s), nil
+    }
+    return "", fmt.Errorf("invalid period %q", s)
+}
+
+// Window - Window ID containing t, e.g. 2026-10-17, 2026-W42, 2026-10
+func (p Period) Window(t time.Time) string {
+    t = t.UTC()
+    switch p {
+    case PeriodDaily:
+        return t.Format("2006-01-02")
+    case PeriodWeekly:
+        year, week := t.ISOWeek()
+        return fmt.Sprintf("%d-W%02d", year, week)
+    case PeriodMonthly:
+        return t.Format("2006-01")
+    }
+    return ""
+}
+
+// Retention - How long a window stays readable after it closed
+func (p Period) Retention() time.Duration {
+    switch p {
+    case PeriodDaily:
+        return 7 * 24 * time.Hour
+    case PeriodWeekly:
+        return 8 * 7 * 24 * time.Hour
+    case PeriodMonthly:
+        return 365 * 24 * time.Hour
+    }
+    return 0
+}
+
+// MaxLength - Longest possible window of the period
+func (p Period) MaxLength() time.Duration {
+    switch p {
+    case PeriodDaily:
+        return 24 * time.Hour
+    case PeriodWeekly:
+        return 7 * 24 * time.Hour
+    case PeriodMonthly:
+        return 31 * 24 * time.Hour
+    }
+    return 0
+}
+
+// PreviousWindow - Window that ended right before the one containing t
+func (p Period) PreviousWindow(t time.Time) string {
+    t = t.UTC()
+    switch p {
+    case PeriodDaily:
+        return p.Window(t.AddDate(0, 0, -1))
+    case PeriodWeekly:
+        return p.Window(t.AddDate(0, 0, -7))
+    case PeriodMonthly:
+        // Step back from the 1st so month lengths don't matter
+        first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+        return p.Window(first.AddDate(0, -1, 0))
+    }
+    return ""
+}
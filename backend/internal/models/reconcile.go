@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ReconcileReport is the outcome of one Redis <-> Postgres comparison of the
+// global board
+type ReconcileReport struct {
+    StartedAt      time.Time `json:"started_at"`
+    FinishedAt     time.Time `json:"finished_at"`
+    Scanned        int64     `json:"scanned"`          // users compared
+    MissingInRedis int64     `json:"missing_in_redis"` // restored from Postgres
+    RedisStale     int64     `json:"redis_stale"`      // Postgres newer, Redis repaired
+    PostgresStale  int64     `json:"postgres_stale"`   // Redis newer, requeued for the DB writer
+    Conflicts      int64     `json:"conflicts"`        // same version, different rating, left alone
+    Orphans        int64     `json:"orphans"`          // on the board but not in users, left alone
+    Error          string    `json:"error,omitempty"`  // run stopped early
+}
+
+// Drift - Every user the stores disagreed on
+func (r ReconcileReport) Drift() int64 {
+    return r.MissingInRedis + r.RedisStale + r.PostgresStale + r.Conflicts + r.Orphans
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Season lifecycle: active -> archiving (standings copied, ratings reset) -> archived
+const (
+    SeasonActive    = "active"
+    SeasonArchiving = "archiving"
+    SeasonArchived  = "archived"
+    SeasonFailed    = "failed"
+)
+
+// Season is a bounded competition on one board
+type Season struct {
+    ID          int64      `db:"id" json:"id"`
+    BoardID     string     `db:"board_id" json:"board_id"`
+    Name        string     `db:"name" json:"name"`
+    Status      string     `db:"status" json:"status"`
+    ResetFactor float64    `db:"reset_factor" json:"reset_factor"`
+    ResetTarget int        `db:"reset_target" json:"reset_target"`
+    ResetVersion int64     `db:"reset_version" json:"-"` // 0 until archiving took it
+    StartedAt   time.Time  `db:"started_at" json:"started_at"`
+    EndedAt     *time.Time `db:"ended_at" json:"ended_at,omitempty"`
+}
+
+// SoftReset - Pull a rating toward the target by the season's reset factor
+// e.g. factor 0.5, target 1000: 1800 -> 1400
+func (s Season) SoftReset(rating int) int {
+    return rating - int(float64(rating-s.ResetTarget)*s.ResetFactor)
+}
+
+// Standing is an archived entry, position doubles as the keyset cursor
+type Standing struct {
+    Position int64 `db:"position" json:"-"`
+    RankedUser
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Snapshot is a compact copy of every rating on a board at TakenAt
+// Times between snapshots are rebuilt from rating_history
+type Snapshot struct {
+    ID      int64     `db:"id" json:"id"`
+    BoardID string    `db:"board_id" json:"board_id"`
+    TakenAt time.Time `db:"taken_at" json:"taken_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+// Window stream message types
+const (
+    WindowSnapshot = "snapshot" // full window, sent on (re)subscribe
+    WindowDiff     = "diff"     // changes since the previous message
+)
+
+// WindowEvent is one message of a live leaderboard window stream
+type WindowEvent struct {
+    Type    string       `json:"type"`
+    BoardID string       `json:"board_id"`
+    Offset  int64        `json:"offset"`
+    Limit   int64        `json:"limit"`
+    Users   []RankedUser `json:"users,omitempty"`   // snapshot only
+    Entered []RankedUser `json:"entered,omitempty"` // now inside the window
+    Left    []int64      `json:"left,omitempty"`    // IDs no longer inside the window
+    Moved   []RankedUser `json:"moved,omitempty"`   // still inside, new rank or rating
+}
+
+// Empty - No changes, nothing worth sending
+func (e WindowEvent) Empty() bool {
+    return e.Type == WindowDiff && len(e.Entered) == 0 && len(e.Left) == 0 && len(e.Moved) == 0
+}
+
+// RatingEvent is a rating change applied in Redis, published to every instance
+type RatingEvent struct {
+    BoardID   string `json:"board"`
+    UserID    int64  `json:"user_id"`
+    OldRating *int   `json:"old_rating"` // nil for the first rating on the board
+    Rating    int    `json:"rating"`
+    Version   int64  `json:"version,string"`
+}
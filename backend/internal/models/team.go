@@ -0,0 +1,51 @@
+package models
+
+import (
+    "fmt"
+    "time"
+)
+
+// TeamAggregate decides how member ratings become a team score
+type TeamAggregate string
+
+const (
+    TeamTop5Avg TeamAggregate = "top5_avg" // average of the best 5 members
+    TeamSum     TeamAggregate = "sum"
+    TeamMedian  TeamAggregate = "median"
+)
+
+// MaxTeamSize - Keeps recomputing a team score on every member update cheap
+const MaxTeamSize = 100
+
+// ParseTeamAggregate - Empty string means top5_avg
+func ParseTeamAggregate(s string) (TeamAggregate, error) {
+    switch TeamAggregate(s) {
+    case "", TeamTop5Avg:
+        return TeamTop5Avg, nil
+    case TeamSum, TeamMedian:
+        return TeamAggregate(s), nil
+    }
+    return "", fmt.Errorf("invalid aggregate %q (use top5_avg, sum or median)", s)
+}
+
+// Team scores are aggregated from the global board ratings of its members
+type Team struct {
+    ID        int64         `db:"id" json:"id"`
+    Name      string        `db:"name" json:"name"`
+    Aggregate TeamAggregate `db:"aggregate" json:"aggregate"`
+    CreatedAt time.Time     `db:"created_at" json:"created_at"`
+}
+
+type RankedTeam struct {
+    Rank    int64   `json:"rank"`
+    ID      int64   `json:"id"`
+    Name    string  `json:"name"`
+    Score   float64 `json:"score"`
+    Members int64   `json:"members"`
+}
+
+// TeamMembership is one row of team_members
+type TeamMembership struct {
+    TeamID int64 `db:"team_id"`
+    UserID int64 `db:"user_id"`
+}
@@ -1,11 +1,22 @@
 package models
 
+import "time"
+
 // User represents a user in the leaderboard
 type User struct {
     ID       int64  `db:"id" json:"id"`
     Username string `db:"username" json:"username"`
     Rating   int    `db:"rating" json:"rating"`
     Version  int64  `db:"version" json:"version"` 
+    // When the current rating was first reached, used for tie-breaking
+    AchievedAt time.Time `db:"rating_achieved_at" json:"-"`
+    // Glicko-2 state, only moved by match results
+    Deviation  float64 `db:"rating_deviation" json:"-"`
+    Volatility float64 `db:"volatility" json:"-"`
+    // Set by the inactivity decay, cleared by the next real update
+    Decayed bool `db:"rating_decayed" json:"-"`
+    // ISO 3166-1 alpha-2 country code, empty if unknown
+    Region string `db:"region" json:"region,omitempty"`
 }
 
 type RankedUser struct {
@@ -13,12 +24,25 @@ type RankedUser struct {
     ID       int64  `json:"id"`
     Username string `json:"username"`
     Rating   int    `json:"rating"`
+    Decayed  bool   `json:"decayed,omitempty"` // Rating lowered by inactivity decay
+    // Only on the global board, for players with a region
+    Region     string `json:"region,omitempty"`
+    RegionRank int64  `json:"region_rank,omitempty"`
+    // Ranked by Postgres while Redis is down
+    Degraded bool `json:"degraded,omitempty"`
 }
 
 type RatingUpdate struct {
-    UserID  int64 `json:"user_id"`
-    Rating  int   `json:"rating"`
-    Version int64 `json:"version"`
+    BoardID    string    `json:"board_id,omitempty"`
+    UserID     int64     `json:"user_id"`
+    Rating     int       `json:"rating"`
+    Version    int64     `json:"version"`
+    AchievedAt time.Time `json:"achieved_at"`
+    // Glicko-2 state, zero keeps the stored value
+    Deviation  float64 `json:"deviation,omitempty"`
+    Volatility float64 `json:"volatility,omitempty"`
+    Decayed    bool    `json:"decayed,omitempty"`
+    Source     string  `json:"source,omitempty"` // see Source* constants
 }
 
 // We are using version for conflict resolution in rating updates
@@ -0,0 +1,36 @@
+package rating
+
+import (
+	"math"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+// Elo - Classic Elo, every team member moves by the team's delta
+type Elo struct {
+	kFactor float64
+}
+
+func NewElo(kFactor float64) *Elo {
+	return &Elo{kFactor: kFactor}
+}
+
+func (e *Elo) Name() string {
+	return "elo"
+}
+
+func (e *Elo) Rate(teamA, teamB []models.PlayerState, scoreA float64) ([]models.PlayerState, []models.PlayerState) {
+	ra, rb := teamRating(teamA), teamRating(teamB)
+	expectedA := 1 / (1 + math.Pow(10, (rb-ra)/400))
+	deltaA := e.kFactor * (scoreA - expectedA)
+	return e.apply(teamA, deltaA), e.apply(teamB, -deltaA)
+}
+
+func (e *Elo) apply(team []models.PlayerState, delta float64) []models.PlayerState {
+	out := make([]models.PlayerState, len(team))
+	for i, p := range team {
+		out[i] = p
+		out[i].Rating = clampRating(float64(p.Rating) + delta)
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package rating
+
+import (
+	"math"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+// Glicko-2 as described in Glickman's paper, each match is its own
+// rating period. Teams are rated against the other team as one opponent.
+const (
+	glickoScale   = 173.7178
+	glickoEpsilon = 0.000001
+)
+
+type Glicko2 struct {
+	tau float64 // constrains volatility change, 0.3 - 1.2
+}
+
+func NewGlicko2(tau float64) *Glicko2 {
+	return &Glicko2{tau: tau}
+}
+
+func (g *Glicko2) Name() string {
+	return "glicko2"
+}
+
+func (g *Glicko2) Rate(teamA, teamB []models.PlayerState, scoreA float64) ([]models.PlayerState, []models.PlayerState) {
+	oppA := compositeOpponent(teamB)
+	oppB := compositeOpponent(teamA)
+	newA := make([]models.PlayerState, len(teamA))
+	for i, p := range teamA {
+		newA[i] = g.update(p, oppA, scoreA)
+	}
+	newB := make([]models.PlayerState, len(teamB))
+	for i, p := range teamB {
+		newB[i] = g.update(p, oppB, 1-scoreA)
+	}
+	return newA, newB
+}
+
+// compositeOpponent - Average rating, root mean square deviation
+func compositeOpponent(team []models.PlayerState) models.PlayerState {
+	var sq float64
+	for _, p := range team {
+		sq += p.Deviation * p.Deviation
+	}
+	return models.PlayerState{
+		Rating:    int(math.Round(teamRating(team))),
+		Deviation: math.Sqrt(sq / float64(len(team))),
+	}
+}
+
+func (g *Glicko2) update(p, opp models.PlayerState, score float64) models.PlayerState {
+	mu := (float64(p.Rating) - 1500) / glickoScale
+	phi := p.Deviation / glickoScale
+	sigma := p.Volatility
+	muJ := (float64(opp.Rating) - 1500) / glickoScale
+	phiJ := opp.Deviation / glickoScale
+
+	gJ := 1 / math.Sqrt(1+3*phiJ*phiJ/(math.Pi*math.Pi))
+	e := 1 / (1 + math.Exp(-gJ*(mu-muJ)))
+	v := 1 / (gJ * gJ * e * (1 - e))
+	delta := v * gJ * (score - e)
+
+	sigma = g.volatility(phi, sigma, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phiNew := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	muNew := mu + phiNew*phiNew*gJ*(score-e)
+
+	out := p
+	out.Rating = clampRating(glickoScale*muNew + 1500)
+	out.Deviation = math.Min(glickoScale*phiNew, models.DefaultDeviation)
+	out.Volatility = sigma
+	return out
+}
+
+// volatility - New sigma via the Illinois algorithm (step 5 of the paper)
+func (g *Glicko2) volatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(g.tau*g.tau)
+	}
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*g.tau) < 0 {
+			k++
+		}
+		B = a - k*g.tau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glickoEpsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
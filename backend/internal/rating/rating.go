@@ -0,0 +1,48 @@
+package rating
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+// System computes new player states from a finished match
+type System interface {
+	Name() string
+	// Rate returns the new state of every player, in the same order.
+	// scoreA is team A's result: 1 win, 0.5 draw, 0 loss
+	Rate(teamA, teamB []models.PlayerState, scoreA float64) (newA, newB []models.PlayerState)
+}
+
+// New - Rating system by name ("elo" or "glicko2")
+func New(name string, kFactor, tau float64) (System, error) {
+	switch name {
+	case "elo":
+		return NewElo(kFactor), nil
+	case "glicko2":
+		return NewGlicko2(tau), nil
+	}
+	return nil, fmt.Errorf("unknown rating system %q", name)
+}
+
+// teamRating - Teams play as one player with the average rating
+func teamRating(team []models.PlayerState) float64 {
+	var sum float64
+	for _, p := range team {
+		sum += float64(p.Rating)
+	}
+	return sum / float64(len(team))
+}
+
+// clampRating - Round and keep within the allowed range
+func clampRating(r float64) int {
+	rating := int(math.Round(r))
+	if rating < models.MinRating {
+		return models.MinRating
+	}
+	if rating > models.MaxRating {
+		return models.MaxRating
+	}
+	return rating
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+type BoardRepository struct {
+	db *sqlx.DB
+}
+
+func NewBoardRepository(db *sqlx.DB) *BoardRepository {
+	return &BoardRepository{db: db}
+}
+
+// GetBoards - All board definitions
+func (r *BoardRepository) GetBoards(ctx context.Context) ([]models.Leaderboard, error) {
+	var boards []models.Leaderboard
+	err := r.db.SelectContext(ctx, &boards,
+		"SELECT id, name, rank_mode, tie_break, created_at FROM leaderboards ORDER BY id")
+	return boards, err
+}
+
+// GetBoard - One board definition, sql.ErrNoRows if it does not exist
+func (r *BoardRepository) GetBoard(ctx context.Context, id string) (*models.Leaderboard, error) {
+	var board models.Leaderboard
+	err := r.db.GetContext(ctx, &board,
+		"SELECT id, name, rank_mode, tie_break, created_at FROM leaderboards WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &board, nil
+}
+
+// CreateBoard - Create new board definition
+func (r *BoardRepository) CreateBoard(ctx context.Context, id, name string, mode models.RankMode, tieBreak bool) (*models.Leaderboard, error) {
+	var board models.Leaderboard
+	err := r.db.GetContext(ctx, &board,
+		"INSERT INTO leaderboards (id, name, rank_mode, tie_break) VALUES ($1, $2, $3, $4) RETURNING id, name, rank_mode, tie_break, created_at",
+		id, name, mode, tieBreak)
+	if err != nil {
+		return nil, err
+	}
+	return &board, nil
+}
+
+// UpdateBoard - Change name and ranking semantics of a board
+func (r *BoardRepository) UpdateBoard(ctx context.Context, id, name string, mode models.RankMode) (*models.Leaderboard, error) {
+	var board models.Leaderboard
+	err := r.db.GetContext(ctx, &board,
+		"UPDATE leaderboards SET name = $2, rank_mode = $3 WHERE id = $1 RETURNING id, name, rank_mode, tie_break, created_at",
+		id, name, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &board, nil
+}
+
+// SetTieBreak - Switch how equal ratings are ordered, true if it changed. The
+// stored scores are only rebuilt by the next cache warm-up.
+func (r *BoardRepository) SetTieBreak(ctx context.Context, id string, tieBreak bool) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE leaderboards SET tie_break = $2 WHERE id = $1 AND tie_break <> $2", id, tieBreak)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetBoardUsers - Used for cache warming of non-global boards
+func (r *BoardRepository) GetBoardUsers(ctx context.Context, boardID string) ([]models.User, error) {
+	var users []models.User
+	err := r.db.SelectContext(ctx, &users,
+		`SELECT u.id, u.username, b.rating, b.version, b.achieved_at AS rating_achieved_at,
+		b.rating_deviation, b.volatility, b.decayed AS rating_decayed
+		FROM board_ratings b JOIN users u ON u.id = b.user_id
+		WHERE b.board_id = $1 ORDER BY u.id`, boardID)
+	return users, err
+}
+
+// GetBoardUsersAfter - Page of a board's ratings by user id, for the
+// reconciler, like UserRepository.GetUsersAfter
+func (r *BoardRepository) GetBoardUsersAfter(ctx context.Context, boardID string, afterID int64, limit int) ([]models.User, error) {
+	var users []models.User
+	err := r.db.SelectContext(ctx, &users,
+		`SELECT u.id, u.username, b.rating, b.version, b.achieved_at AS rating_achieved_at,
+		b.rating_deviation, b.volatility, b.decayed AS rating_decayed
+		FROM board_ratings b JOIN users u ON u.id = b.user_id
+		WHERE b.board_id = $1 AND b.user_id > $2 ORDER BY b.user_id LIMIT $3`, boardID, afterID, limit)
+	return users, err
+}
+
+// GetBoardVersions - Current version of each user rated on a board
+func (r *BoardRepository) GetBoardVersions(ctx context.Context, boardID string, ids []int64) (map[int64]int64, error) {
+	var rows []struct {
+		ID      int64 `db:"user_id"`
+		Version int64 `db:"version"`
+	}
+	err := r.db.SelectContext(ctx, &rows,
+		"SELECT user_id, version FROM board_ratings WHERE board_id = $1 AND user_id = ANY($2)", boardID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		versions[row.ID] = row.Version
+	}
+	return versions, nil
+}
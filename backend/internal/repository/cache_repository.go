@@ -2,171 +2,1014 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/stilln0thing/matiks_leaderboard/internal/models"
 )
 
+// windowExpiryLua - Lua helper giving the time-windowed sets (zkeys[2..], in
+// models.WindowedPeriods order) and their :scores indexes a TTL on first
+// write. It covers the whole window plus its retention, so closed windows
+// expire even if the period roller never sees them.
+var windowExpiryLua = func() string {
+	ttls := make([]string, len(models.WindowedPeriods))
+	for i, p := range models.WindowedPeriods {
+		ttls[i] = strconv.FormatInt(int64(WindowTTL(p)/time.Second), 10)
+	}
+	return `
+local windowTTLs = {` + strings.Join(ttls, ", ") + `}
+
+local function expireWindows(zkeys)
+    for i = 2, #zkeys do
+        redis.call('EXPIRE', zkeys[i], windowTTLs[i - 1], 'NX')
+        redis.call('EXPIRE', zkeys[i] .. ':scores', windowTTLs[i - 1], 'NX')
+    end
+end
+`
+}()
+
+// WindowTTL - Lifetime of a time-windowed set from its first write
+func WindowTTL(p models.Period) time.Duration {
+	return p.MaxLength() + p.Retention()
+}
+
+// applyRatingLua - Lua helper shared by every write path. zkeys is the board
+// set followed by the current time-windowed sets, f holds the per-board hash
+// field names (see fieldArgs). active is the last-active time to record, empty
+// for writes that are not player activity. Returns 0 for a stale version, 1 when applied.
+// Applied changes are published on ChangesChannel.
+var applyRatingLua = setScoreLua + teamLua + versionLua + windowExpiryLua + `
+local function fieldsAt(i)
+    return {rating = ARGV[i], version = ARGV[i + 1], achieved = ARGV[i + 2], active = ARGV[i + 3],
+        decayed = ARGV[i + 4], peak = ARGV[i + 5], board = ARGV[i + 6]}
+end
+
+local function applyRating(zkeys, hashKey, member, rating, version, achieved, tieBreak, active, f)
+    local oldVersion = redis.call('HGET', hashKey, f.version)
+    if oldVersion and not newerVersion(version, oldVersion) then
+        return 0  -- Stale update, ignore!
+    end
+    local oldRating = redis.call('HGET', hashKey, f.rating)
+    -- Same rating again keeps the original achievement time
+    if oldRating == rating then
+        achieved = redis.call('HGET', hashKey, f.achieved) or achieved
+    end
+    local score = rating
+    if tieBreak == '1' then
+        score = string.format('%.17g', tonumber(rating) + 1 - tonumber(achieved) / 4294967296)
+    end
+    for _, key in ipairs(zkeys) do
+        setScore(key, member, score, rating)
+    end
+    expireWindows(zkeys)
+    redis.call('HSET', hashKey, f.rating, rating, f.version, version, f.achieved, achieved)
+    -- Best competition rank seen at a write, for the rating history
+    local rank = redis.call('ZCOUNT', zkeys[1], math.floor(tonumber(score)) + 1, '+inf') + 1
+    local peak = redis.call('HGET', hashKey, f.peak)
+    if not peak or rank < tonumber(peak) then
+        redis.call('HSET', hashKey, f.peak, rank)
+    end
+    if active ~= '' then
+        redis.call('HSET', hashKey, f.active, active)
+        -- Hourly rating change per player for the movers list, see moversBucket
+        local change = oldRating and tonumber(rating) - tonumber(oldRating) or 0
+        if change ~= 0 then
+            local bucket = zkeys[1] .. ':movers:' .. math.floor(tonumber(active) / 3600)
+            redis.call('ZINCRBY', bucket, change, member)
+            redis.call('EXPIRE', bucket, 694800)
+        end
+    end
+    -- Team scores and regional boards follow the global board
+    if f.board == '` + models.DefaultBoard + `' then
+        updateTeam(hashKey, member, rating)
+        local region = redis.call('HGET', hashKey, 'region')
+        if region then
+            setScore('leaderboard:region:' .. region .. ':zset', member, score, rating)
+        end
+    end
+    -- Any newer rating replaces a decayed one
+    redis.call('HDEL', hashKey, f.decayed)
+    -- Tell every instance, version stays a string as Lua numbers are doubles
+    redis.call('PUBLISH', '` + ChangesChannel + `', cjson.encode({board = f.board, user_id = tonumber(member),
+        old_rating = oldRating and tonumber(oldRating) or cjson.null, rating = tonumber(rating), version = version}))
+    return 1
+end
+`
+
 // Lua script for ATOMIC rating update with version check
+// KEYS: board set, user hash, windowed sets. ARGV[8..]: member, rating,
+// version, achieved, tieBreak, active, expected version (empty for any)
+// Returns {1 applied / 0 stale / -1 expected version mismatch, rating, version}
+// with the rating and version stored afterwards, nil for an unknown user
+var updateRatingScript = applyRatingLua + `
+if redis.call('HEXISTS', KEYS[2], 'username') == 0 then
+    return false  -- Unknown user
+end
+local f = fieldsAt(1)
+local status = -1
+local current = redis.call('HGET', KEYS[2], f.version) or '0'
+if ARGV[14] == '' or ARGV[14] == current then
+    local zkeys = {KEYS[1]}
+    for i = 3, #KEYS do
+        table.insert(zkeys, KEYS[i])
+    end
+    status = applyRating(zkeys, KEYS[2], ARGV[8], ARGV[9], ARGV[10], ARGV[11], ARGV[12], ARGV[13], f)
+end
+return {status, redis.call('HGET', KEYS[2], f.rating) or '0', redis.call('HGET', KEYS[2], f.version) or '0'}
+`
+
+// Lua script for an ATOMIC relative update: read, add, clamp and apply in
+// one step so concurrent deltas are never lost. Same KEYS as updateRatingScript
+// ARGV[8..]: member, delta, version, achieved, tieBreak, active, min, max, default
+// Returns {1 applied / 0 stale, rating, version} like updateRatingScript; a
+// stale delta was not added and must be retried with a newer version
+var deltaRatingScript = applyRatingLua + `
+if redis.call('HEXISTS', KEYS[2], 'username') == 0 then
+    return false  -- Unknown user
+end
+local f = fieldsAt(1)
+local current = tonumber(redis.call('HGET', KEYS[2], f.rating) or ARGV[16])
+local rating = math.max(tonumber(ARGV[14]), math.min(tonumber(ARGV[15]), current + tonumber(ARGV[9])))
+local zkeys = {KEYS[1]}
+for i = 3, #KEYS do
+    table.insert(zkeys, KEYS[i])
+end
+local applied = applyRating(zkeys, KEYS[2], ARGV[8], tostring(rating), ARGV[10], ARGV[11], ARGV[12], ARGV[13], f)
+return {applied, redis.call('HGET', KEYS[2], f.rating) or '0', redis.call('HGET', KEYS[2], f.version) or '0'}
+`
+
+// Lua script for a batch of absolute updates in one round trip.
+// KEYS: ARGV[8] rating sets, then one user hash per item.
+// ARGV[9..12]: version, achieved, tieBreak, active
+// ARGV[13..]: member, rating per item. Returns 1 applied, 0 stale, -1 unknown user
+var batchRatingScript = applyRatingLua + `
+local nz = tonumber(ARGV[8])
+local zkeys = {}
+for i = 1, nz do
+    zkeys[i] = KEYS[i]
+end
+local f = fieldsAt(1)
+local results = {}
+for i = 1, #KEYS - nz do
+    local hashKey = KEYS[nz + i]
+    if redis.call('HEXISTS', hashKey, 'username') == 0 then
+        results[i] = -1
+    else
+        local base = 13 + (i - 1) * 2
+        results[i] = applyRating(zkeys, hashKey, ARGV[base], ARGV[base + 1], ARGV[9], ARGV[10], ARGV[11], ARGV[12], f)
+    end
+end
+return results
+`
+
+// Lua script for an ATOMIC all-or-nothing match result.
+// KEYS: ARGV[8] rating sets, then one user hash per player.
+// ARGV[9..14]: deviation field, volatility field, version, achieved, tieBreak, active
+// ARGV[15..]: member, expected version, rating, deviation, volatility per player
+var applyMatchScript = applyRatingLua + `
+local nz = tonumber(ARGV[8])
+local zkeys = {}
+for i = 1, nz do
+    zkeys[i] = KEYS[i]
+end
+local f = fieldsAt(1)
+local players = #KEYS - nz
+-- Everybody must still be at the version the new ratings were computed from
+for i = 1, players do
+    local current = redis.call('HGET', KEYS[nz + i], f.version) or '0'
+    if current ~= ARGV[15 + (i - 1) * 5 + 1] or not newerVersion(ARGV[11], current) then
+        return 0
+    end
+end
+for i = 1, players do
+    local base = 15 + (i - 1) * 5
+    applyRating(zkeys, KEYS[nz + i], ARGV[base], ARGV[base + 2], ARGV[11], ARGV[12], ARGV[13], ARGV[14], f)
+    redis.call('HSET', KEYS[nz + i], ARGV[9], ARGV[base + 3], ARGV[10], ARGV[base + 4])
+end
+return 1
+`
 
-const updateRatingScript = `
-local oldVersion = redis.call('HGET', KEYS[2], 'version')
-if oldVersion and tonumber(ARGV[3]) <= tonumber(oldVersion) then
-    return 0  -- Stale update, ignore!
+// Lua script for inactivity decay. KEYS: board set, then one user hash per
+// member. ARGV[8..13]: version, achieved, tieBreak, cutoff, points, floor.
+// Players active since the cutoff or already at the floor are skipped; the
+// decay goes through applyRating so a fresher version always wins.
+// ARGV[14..]: members. Returns the decayed rating per member, 0 when skipped
+var decayRatingScript = applyRatingLua + `
+local f = fieldsAt(1)
+local cutoff = tonumber(ARGV[11])
+local points = tonumber(ARGV[12])
+local floor = tonumber(ARGV[13])
+local results = {}
+for i = 1, #KEYS - 1 do
+    local hashKey = KEYS[1 + i]
+    local current = redis.call('HGET', hashKey, f.rating)
+    local active = tonumber(redis.call('HGET', hashKey, f.active) or '0')
+    results[i] = 0
+    if current and active < cutoff then
+        current = tonumber(current)
+        local rating = math.max(floor, current - points)
+        if rating < current and applyRating({KEYS[1]}, hashKey, ARGV[13 + i], tostring(rating), ARGV[8], ARGV[9], ARGV[10], '', f) == 1 then
+            redis.call('HSET', hashKey, f.decayed, '1')
+            results[i] = rating
+        end
+    end
+end
+return results
+`
+
+// Lua script for a version-guarded cache warm-up of part of a board.
+// KEYS: board set, then one user hash per user. ARGV[1..7]: field block,
+// ARGV[8..11]: deviation field, volatility field, tieBreak, regions (global
+// board only). ARGV[12..]: member, username, rating, version, achieved,
+// deviation, volatility, decayed, region per user. A newer version in Redis
+// is an update still queued for Postgres and is kept, only re-indexed.
+var warmScript = setScoreLua + versionLua + `
+local function scoreOf(rating, achieved)
+    if ARGV[10] == '1' then
+        return string.format('%.17g', tonumber(rating) + 1 - tonumber(achieved) / 4294967296)
+    end
+    return rating
+end
+
+for i = 2, #KEYS do
+    local hashKey = KEYS[i]
+    local base = 12 + (i - 2) * 9
+    local member, rating, version, achieved = ARGV[base], ARGV[base + 2], ARGV[base + 3], ARGV[base + 4]
+    redis.call('HSET', hashKey, 'username', ARGV[base + 1])
+    local stored = redis.call('HGET', hashKey, ARGV[2])
+    if stored and newerVersion(stored, version) then
+        rating = redis.call('HGET', hashKey, ARGV[1])
+        achieved = redis.call('HGET', hashKey, ARGV[3]) or achieved
+    else
+        redis.call('HSET', hashKey, ARGV[1], rating, ARGV[2], version, ARGV[3], achieved,
+            ARGV[8], ARGV[base + 5], ARGV[9], ARGV[base + 6])
+        if ARGV[base + 7] == '1' then
+            redis.call('HSET', hashKey, ARGV[5], '1')
+        else
+            redis.call('HDEL', hashKey, ARGV[5])
+        end
+    end
+    if rating then
+        local score = scoreOf(rating, achieved)
+        setScore(KEYS[1], member, score, rating)
+        if ARGV[11] == '1' then
+            local region = ARGV[base + 8]
+            if region == '' then
+                redis.call('HDEL', hashKey, 'region')
+            else
+                redis.call('HSET', hashKey, 'region', region)
+                setScore('leaderboard:region:' .. region .. ':zset', member, score, rating)
+            end
+        end
+    end
 end
-redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
-redis.call('HSET', KEYS[2], 'rating', ARGV[2], 'version', ARGV[3])
 return 1
 `
+
+// Lua script for moving a user between regional boards. KEYS: global set,
+// user hash. ARGV: member, new region (empty to clear)
+const setRegionScript = setScoreLua + `
+local old = redis.call('HGET', KEYS[2], 'region')
+if old then
+    removeScore('leaderboard:region:' .. old .. ':zset', ARGV[1])
+    redis.call('HDEL', KEYS[2], 'region')
+end
+if ARGV[2] ~= '' then
+    redis.call('HSET', KEYS[2], 'region', ARGV[2])
+    local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+    if score then
+        setScore('leaderboard:region:' .. ARGV[2] .. ':zset', ARGV[1], score, math.floor(tonumber(score)))
+    end
+end
+return 1
+`
+
+// Lua script for the summed rating changes of the last buckets. KEYS: result
+// key, then the buckets. The union is cached in the result key for ARGV[1]
+// seconds. ARGV[2] up or down, ARGV[3] limit. Returns member, change pairs
+const moversScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+    local buckets = {}
+    for i = 2, #KEYS do
+        buckets[i - 1] = KEYS[i]
+    end
+    redis.call('ZUNIONSTORE', KEYS[1], #buckets, unpack(buckets))
+    redis.call('EXPIRE', KEYS[1], ARGV[1])
+end
+if ARGV[2] == 'down' then
+    return redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', '(0', 'WITHSCORES', 'LIMIT', 0, ARGV[3])
+end
+return redis.call('ZREVRANGEBYSCORE', KEYS[1], '+inf', '(0', 'WITHSCORES', 'LIMIT', 0, ARGV[3])
+`
+
+// Lua script for an ATOMIC page read
+const pageScript = rankWindowLua + `
+return rankWindow(KEYS[1], tonumber(ARGV[1]), tonumber(ARGV[2]))
+`
+
+// Lua script for an ATOMIC neighbourhood read around a member
+const aroundUserScript = rankWindowLua + `
+local pos = redis.call('ZREVRANK', KEYS[1], ARGV[1])
+if not pos then
+    return false
+end
+local start = pos - tonumber(ARGV[2])
+if start < 0 then
+    start = 0
+end
+return rankWindow(KEYS[1], start, pos + tonumber(ARGV[2]))
+`
+
+var ErrUserNotCached = errors.New("user not found in cache")
+
+var (
+	// ErrStaleUpdate - A newer version was already stored, the update was ignored
+	ErrStaleUpdate = errors.New("stale update ignored")
+	// ErrVersionMismatch - The stored version is not the expected one
+	ErrVersionMismatch = errors.New("rating changed since expected version")
+)
+
+// IsUnavailable - Whether err means Redis could not be reached, as opposed to
+// an error reply, a missing key or a cancelled request
+func IsUnavailable(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var reply redis.Error
+	if errors.As(err, &reply) {
+		// Still loading its data after a restart
+		return strings.HasPrefix(reply.Error(), "LOADING")
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, redis.ErrClosed) || errors.Is(err, redis.ErrPoolTimeout)
+}
+
 const (
-	LeaderboardKey = "leaderboard:zset" // Sorted set for rankings
-	UserHashPrefix = "user:hash:"       // Hash for user metadata
+	LeaderboardKey  = "leaderboard:zset"    // Sorted set for rankings (global board)
+	BoardKeyPrefix  = "leaderboard:"        // Prefix for per-board sorted sets
+	RegionKeyPrefix = "leaderboard:region:" // Prefix for regional slices of the global board
+	UserHashPrefix  = "user:hash:"          // Hash for user metadata
 )
 
+// BoardKey - Sorted set key for a board
+// The global board keeps the original key so existing data stays valid
+func BoardKey(board string) string {
+	if board == "" || board == models.DefaultBoard {
+		return LeaderboardKey
+	}
+	return BoardKeyPrefix + board + ":zset"
+}
+
+// RegionKey - Sorted set key for one region of the global board
+func RegionKey(region string) string {
+	return RegionKeyPrefix + region + ":zset"
+}
+
+// PeriodKey - Sorted set key for one time window of a board
+// e.g. leaderboard:zset:2026-W42, alltime maps to BoardKey
+func PeriodKey(board string, period models.Period, window string) string {
+	if period == models.PeriodAllTime || window == "" {
+		return BoardKey(board)
+	}
+	return BoardKey(board) + ":" + window
+}
+
+// ratingField / versionField / achievedField - Per-board fields inside the user hash
+func ratingField(board string) string {
+	if board == "" || board == models.DefaultBoard {
+		return "rating"
+	}
+	return "rating:" + board
+}
+
+func versionField(board string) string {
+	if board == "" || board == models.DefaultBoard {
+		return "version"
+	}
+	return "version:" + board
+}
+
+func achievedField(board string) string {
+	if board == "" || board == models.DefaultBoard {
+		return "achieved"
+	}
+	return "achieved:" + board
+}
+
+// deviationField / volatilityField - Glicko-2 state, unused by Elo
+func deviationField(board string) string {
+	if board == "" || board == models.DefaultBoard {
+		return "rd"
+	}
+	return "rd:" + board
+}
+
+func volatilityField(board string) string {
+	if board == "" || board == models.DefaultBoard {
+		return "vol"
+	}
+	return "vol:" + board
+}
+
+// activeField / decayedField - Last real rating write (unix seconds) and
+// whether the current rating came from inactivity decay
+func activeField(board string) string {
+	if board == "" || board == models.DefaultBoard {
+		return "active"
+	}
+	return "active:" + board
+}
+
+func decayedField(board string) string {
+	if board == "" || board == models.DefaultBoard {
+		return "decayed"
+	}
+	return "decayed:" + board
+}
+
+// peakRankField - Best competition rank the user held right after a write
+func peakRankField(board string) string {
+	if board == "" || board == models.DefaultBoard {
+		return "peak_rank"
+	}
+	return "peak_rank:" + board
+}
+
+// moversBucket - Granularity of the rolling rating change sets, buckets are
+// kept for MaxMoversWindow plus one bucket (mirrored in applyRatingLua)
+const (
+	moversBucket    = time.Hour
+	MaxMoversWindow = 7 * 24 * time.Hour
+	moversCacheTTL  = 10 * time.Second
+)
+
+// moversKeys - Buckets covering window, newest (partial) bucket first. The
+// window is rounded up to whole buckets plus the partial current one, so it
+// covers between window and window + one bucket, never less
+func moversKeys(board string, now time.Time, window time.Duration) []string {
+	n := int64((window+moversBucket-1)/moversBucket) + 1
+	current := now.Unix() / int64(moversBucket/time.Second)
+	keys := make([]string, 0, n)
+	for i := int64(0); i < n; i++ {
+		keys = append(keys, BoardKey(board)+":movers:"+strconv.FormatInt(current-i, 10))
+	}
+	return keys
+}
+
+// fieldArgs - Leading ARGV of every write script, read by fieldsAt
+func fieldArgs(board string) []interface{} {
+	return []interface{}{
+		ratingField(board), versionField(board), achievedField(board), activeField(board),
+		decayedField(board), peakRankField(board), boardOrDefault(board),
+	}
+}
+
+func boardOrDefault(board string) string {
+	if board == "" {
+		return models.DefaultBoard
+	}
+	return board
+}
+
+// ratingKeys - Board set plus the time-windowed sets every write feeds
+func ratingKeys(board string, now time.Time) []string {
+	keys := []string{BoardKey(board)}
+	for _, p := range models.WindowedPeriods {
+		keys = append(keys, PeriodKey(board, p, p.Window(now)))
+	}
+	return keys
+}
+
 type CacheRepository struct {
 	client       *redis.Client
 	updateScript *redis.Script
+	deltaScript  *redis.Script
+	batchScript  *redis.Script
+	rankScript   *redis.Script
+	matchScript  *redis.Script
+	pageScript   *redis.Script
+	cursorScript *redis.Script
+	aroundScript *redis.Script
+	decayScript  *redis.Script
+	moversScript *redis.Script
+	regionScript *redis.Script
+	warmScript   *redis.Script
+
+	joinTeamScript  *redis.Script
+	leaveTeamScript *redis.Script
+	setTeamScript   *redis.Script
+
+	nextVersionScript *redis.Script
+	seedVersionScript *redis.Script
 }
 
 func NewCacheRepository(client *redis.Client) *CacheRepository {
 	return &CacheRepository{
 		client:       client,
 		updateScript: redis.NewScript(updateRatingScript),
+		deltaScript:  redis.NewScript(deltaRatingScript),
+		batchScript:  redis.NewScript(batchRatingScript),
+		rankScript:   redis.NewScript(rankScript),
+		matchScript:  redis.NewScript(applyMatchScript),
+		pageScript:   redis.NewScript(pageScript),
+		cursorScript: redis.NewScript(cursorWindowLua),
+		aroundScript: redis.NewScript(aroundUserScript),
+		decayScript:  redis.NewScript(decayRatingScript),
+		moversScript: redis.NewScript(moversScript),
+		regionScript: redis.NewScript(setRegionScript),
+		warmScript:   redis.NewScript(warmScript),
+
+		joinTeamScript:  redis.NewScript(joinTeamScript),
+		leaveTeamScript: redis.NewScript(leaveTeamScript),
+		setTeamScript:   redis.NewScript(setTeamScript),
+
+		nextVersionScript: redis.NewScript(nextVersionScript),
+		seedVersionScript: redis.NewScript(seedVersionScript),
 	}
 }
 
 // UpdateRating - Atomic update using Lua script
-func (r *CacheRepository) UpdateRating(ctx context.Context, userID int64, rating int, version int64) error {
-	userIDStr := strconv.FormatInt(userID, 10)
+// tieBreak orders equal ratings by u.AchievedAt (earliest first). With
+// expectedVersion set the update only applies while that version is stored
+// (0: not rated yet). Returns the rating and version stored afterwards, also
+// along with ErrStaleUpdate and ErrVersionMismatch. Unknown users are refused
+// with ErrUserNotCached, on every board.
+func (r *CacheRepository) UpdateRating(ctx context.Context, u models.RatingUpdate, tieBreak bool, expectedVersion *int64) (models.PlayerState, error) {
+	userIDStr := strconv.FormatInt(u.UserID, 10)
 	hashKey := UserHashPrefix + userIDStr
-	_, err := r.updateScript.Run(ctx, r.client,
-		[]string{LeaderboardKey, hashKey},
-		userIDStr, rating, version,
-	).Int()
+	zkeys := ratingKeys(u.BoardID, time.Now())
+	keys := append([]string{zkeys[0], hashKey}, zkeys[1:]...)
+	expected := ""
+	if expectedVersion != nil {
+		expected = strconv.FormatInt(*expectedVersion, 10)
+	}
+	res, err := r.updateScript.Run(ctx, r.client,
+		keys,
+		append(fieldArgs(u.BoardID),
+			userIDStr, u.Rating, u.Version, achievedSeconds(u.AchievedAt), tieBreak, time.Now().Unix(), expected)...,
+	).Slice()
+	if err == redis.Nil {
+		return models.PlayerState{}, ErrUserNotCached
+	}
 	if err != nil {
-		return err
+		return models.PlayerState{}, err
 	}
-	// result == 0 means stale update was ignored (version conflict)
-	return nil
+	return updateResult(u.UserID, res)
 }
 
-// GetRank - Get user's rank using ZCOUNT
-// This is O(log N) which scales well!
-func (r *CacheRepository) GetRank(ctx context.Context, userID int64) (int64, int, error) {
-	userIDStr := strconv.FormatInt(userID, 10)
+// updateResult - Decode {status, rating, version} of updateRatingScript
+func updateResult(userID int64, res []interface{}) (models.PlayerState, error) {
+	state := models.PlayerState{UserID: userID}
+	if len(res) != 3 {
+		return state, fmt.Errorf("unexpected update result: %v", res)
+	}
+	status, _ := res[0].(int64)
+	rating, _ := res[1].(string)
+	version, _ := res[2].(string)
+	state.Rating, _ = strconv.Atoi(rating)
+	state.Version, _ = strconv.ParseInt(version, 10, 64)
+	switch status {
+	case 0:
+		return state, ErrStaleUpdate
+	case -1:
+		return state, ErrVersionMismatch
+	}
+	return state, nil
+}
+
+// UpdateRatingBy - Atomic relative update, u.Rating is ignored
+// Returns the clamped absolute rating that was written and its version, the
+// stored ones with ErrStaleUpdate if a newer version was already there
+func (r *CacheRepository) UpdateRatingBy(ctx context.Context, u models.RatingUpdate, delta int, tieBreak bool) (models.PlayerState, error) {
+	userIDStr := strconv.FormatInt(u.UserID, 10)
 	hashKey := UserHashPrefix + userIDStr
-	// Get user's current rating
-	ratingStr, err := r.client.HGet(ctx, hashKey, "rating").Result()
+	zkeys := ratingKeys(u.BoardID, time.Now())
+	keys := append([]string{zkeys[0], hashKey}, zkeys[1:]...)
+	res, err := r.deltaScript.Run(ctx, r.client,
+		keys,
+		append(fieldArgs(u.BoardID),
+			userIDStr, delta, u.Version, achievedSeconds(u.AchievedAt), tieBreak, time.Now().Unix(),
+			models.MinRating, models.MaxRating, models.DefaultRating)...,
+	).Slice()
 	if err == redis.Nil {
-		return 0, 0, fmt.Errorf("user not found in cache")
+		return models.PlayerState{}, ErrUserNotCached
 	}
 	if err != nil {
-		return 0, 0, err
-	}
-	rating, _ := strconv.Atoi(ratingStr)
-	// Count users with HIGHER rating
-	// rank = count of users with rating > this user's rating + 1
-	count, err := r.client.ZCount(ctx, LeaderboardKey,
-		fmt.Sprintf("(%d", rating), "+inf",
-	).Result()
+		return models.PlayerState{}, err
+	}
+	return updateResult(u.UserID, res)
+}
+
+// UpdateRatings - Apply many absolute updates of one board in one round trip
+// All updates share version and achievement time. Returns per update:
+// 1 applied, 0 stale, -1 unknown user. Without windows only the all-time set
+// is touched and players are not marked active, for bookkeeping writes that
+// are not player activity
+func (r *CacheRepository) UpdateRatings(ctx context.Context, board string, tieBreak, windows bool, version int64, achievedAt time.Time, updates []models.RatingUpdate) ([]int64, error) {
+	now := time.Now()
+	zkeys := ratingKeys(board, now)
+	active := strconv.FormatInt(now.Unix(), 10)
+	if !windows {
+		zkeys = zkeys[:1]
+		active = ""
+	}
+	keys := append([]string{}, zkeys...)
+	args := append(fieldArgs(board), len(zkeys), version, achievedSeconds(achievedAt), tieBreak, active)
+	for _, u := range updates {
+		userIDStr := strconv.FormatInt(u.UserID, 10)
+		keys = append(keys, UserHashPrefix+userIDStr)
+		args = append(args, userIDStr, u.Rating)
+	}
+	return r.batchScript.Run(ctx, r.client, keys, args...).Int64Slice()
+}
+
+// GetPlayerStates - Current rating state of every player, in order
+// Players without a rating on the board get the defaults, unknown users fail
+func (r *CacheRepository) GetPlayerStates(ctx context.Context, board string, userIDs []int64) ([]models.PlayerState, error) {
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(userIDs))
+	for i, id := range userIDs {
+		cmds[i] = pipe.HMGet(ctx, UserHashPrefix+strconv.FormatInt(id, 10),
+			"username", ratingField(board), versionField(board), deviationField(board), volatilityField(board))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	states := make([]models.PlayerState, len(userIDs))
+	for i, cmd := range cmds {
+		vals := cmd.Val()
+		if vals[0] == nil {
+			return nil, fmt.Errorf("%w: %d", ErrUserNotCached, userIDs[i])
+		}
+		states[i] = models.PlayerState{
+			UserID:     userIDs[i],
+			Rating:     models.DefaultRating,
+			Deviation:  models.DefaultDeviation,
+			Volatility: models.DefaultVolatility,
+		}
+		if v, ok := vals[1].(string); ok {
+			states[i].Rating, _ = strconv.Atoi(v)
+		}
+		if v, ok := vals[2].(string); ok {
+			states[i].Version, _ = strconv.ParseInt(v, 10, 64)
+		}
+		// Glicko-2 breaks down on zero deviation/volatility, keep defaults
+		if v, ok := vals[3].(string); ok {
+			if rd, _ := strconv.ParseFloat(v, 64); rd > 0 {
+				states[i].Deviation = rd
+			}
+		}
+		if v, ok := vals[4].(string); ok {
+			if vol, _ := strconv.ParseFloat(v, 64); vol > 0 {
+				states[i].Volatility = vol
+			}
+		}
+	}
+	return states, nil
+}
+
+// ApplyMatch - Write new states of all players in one atomic step
+// Each state's Version must be the version it was read at; returns false
+// without writing anything if any player changed in the meantime
+func (r *CacheRepository) ApplyMatch(ctx context.Context, board string, tieBreak bool, version int64, achievedAt time.Time, read, updated []models.PlayerState) (bool, error) {
+	now := time.Now()
+	zkeys := ratingKeys(board, now)
+	keys := append([]string{}, zkeys...)
+	args := append(fieldArgs(board), len(zkeys), deviationField(board), volatilityField(board),
+		version, achievedSeconds(achievedAt), tieBreak, now.Unix())
+	for i, p := range updated {
+		userIDStr := strconv.FormatInt(p.UserID, 10)
+		keys = append(keys, UserHashPrefix+userIDStr)
+		args = append(args, userIDStr, read[i].Version, p.Rating, p.Deviation, p.Volatility)
+	}
+	applied, err := r.matchScript.Run(ctx, r.client, keys, args...).Int()
 	if err != nil {
-		return 0, 0, err
+		return false, err
 	}
-	return count + 1, rating, nil // +1 for 1-indexed rank
+	return applied == 1, nil
+}
+
+// DecayRatings - Lower the rating of every user inactive since cutoff by
+// points, never below floor. Only the all-time set is touched, decay is not
+// activity. Returns the new rating per user, 0 where nothing was applied
+func (r *CacheRepository) DecayRatings(ctx context.Context, board string, tieBreak bool, version int64, achievedAt, cutoff time.Time, points, floor int, userIDs []int64) ([]int64, error) {
+	keys := []string{BoardKey(board)}
+	args := append(fieldArgs(board), version, achievedSeconds(achievedAt), tieBreak, cutoff.Unix(), points, floor)
+	for _, id := range userIDs {
+		userIDStr := strconv.FormatInt(id, 10)
+		keys = append(keys, UserHashPrefix+userIDStr)
+		args = append(args, userIDStr)
+	}
+	return r.decayScript.Run(ctx, r.client, keys, args...).Int64Slice()
+}
+
+// GetRank - Get user's rank in the given mode, Username is left empty
+// All modes are ZCOUNT/ZREVRANK based, O(log N) which scales well!
+func (r *CacheRepository) GetRank(ctx context.Context, board string, mode models.RankMode, userID int64) (*models.RankedUser, error) {
+	userIDStr := strconv.FormatInt(userID, 10)
+	res, err := r.rankScript.Run(ctx, r.client,
+		[]string{BoardKey(board), UserHashPrefix + userIDStr},
+		userIDStr, decayedField(board), board == "" || board == models.DefaultBoard,
+	).Slice()
+	if err == redis.Nil {
+		return nil, ErrUserNotCached
+	}
+	if err != nil {
+		return nil, err
+	}
+	score, _ := strconv.ParseFloat(res[0].(string), 64)
+	user := &models.RankedUser{
+		Rank:    rankFor(mode, res[1].(int64), res[2].(int64), res[3].(int64)),
+		ID:      userID,
+		Rating:  scoreRating(score),
+		Decayed: res[4].(int64) == 1,
+		Region:  res[5].(string),
+	}
+	if user.Region != "" {
+		user.RegionRank = rankFor(mode, res[6].(int64), res[7].(int64), res[8].(int64))
+	}
+	return user, nil
+}
+
+// SetRegion - Move a user to another regional board, empty region clears it
+func (r *CacheRepository) SetRegion(ctx context.Context, userID int64, region string) error {
+	userIDStr := strconv.FormatInt(userID, 10)
+	return r.regionScript.Run(ctx, r.client,
+		[]string{LeaderboardKey, UserHashPrefix + userIDStr},
+		userIDStr, region,
+	).Err()
+}
+
+// AttachGlobalRanks - Turn ranks of a regional page into region ranks and
+// fill in each player's rank on the global board
+func (r *CacheRepository) AttachGlobalRanks(ctx context.Context, mode models.RankMode, users []models.RankedUser) error {
+	if len(users) == 0 {
+		return nil
+	}
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(users))
+	for i, u := range users {
+		above := strconv.Itoa(u.Rating + 1)
+		switch mode {
+		case models.RankDense:
+			cmds[i] = pipe.ZCount(ctx, ScoresKey(LeaderboardKey), above, "+inf")
+		case models.RankOrdinal:
+			cmds[i] = pipe.ZRevRank(ctx, LeaderboardKey, strconv.FormatInt(u.ID, 10))
+		default:
+			cmds[i] = pipe.ZCount(ctx, LeaderboardKey, above, "+inf")
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return err
+	}
+	for i := range users {
+		users[i].RegionRank = users[i].Rank
+		users[i].Rank = cmds[i].Val() + 1
+	}
+	return nil
 }
 
 // GetLeaderboard - Paginated leaderboard with tie-aware ranking
-func (r *CacheRepository) GetLeaderboard(ctx context.Context, limit, offset int64) ([]models.RankedUser, error) {
+// key is a BoardKey or PeriodKey of board
+func (r *CacheRepository) GetLeaderboard(ctx context.Context, board, key string, mode models.RankMode, limit, offset int64) (*models.Page, error) {
 	// Get user IDs and scores from sorted set (descending order)
-	results, err := r.client.ZRevRangeWithScores(ctx, LeaderboardKey, offset, offset+limit-1).Result()
+	res, err := r.pageScript.Run(ctx, r.client,
+		[]string{key},
+		offset, offset+limit-1,
+	).Slice()
+	if err != nil {
+		return nil, err
+	}
+	return r.page(ctx, board, parseRankedWindow(res), mode, limit, false)
+}
+
+// GetLeaderboardAfter - Keyset page next to (or before) the cursor entry
+// Unlike offsets this never repeats or skips players when ratings move
+func (r *CacheRepository) GetLeaderboardAfter(ctx context.Context, board, key string, mode models.RankMode, cursor models.Cursor, limit int64) (*models.Page, error) {
+	res, err := r.cursorScript.Run(ctx, r.client,
+		[]string{key},
+		cursor.Score, cursor.Member, cursor.Prev, limit,
+	).Slice()
+	if err != nil {
+		return nil, err
+	}
+	return r.page(ctx, board, parseRankedWindow(res), mode, limit, cursor.Prev)
+}
+
+// page - Hydrated window plus cursors to its neighbours
+func (r *CacheRepository) page(ctx context.Context, board string, w rankedWindow, mode models.RankMode, limit int64, backward bool) (*models.Page, error) {
+	users, err := r.hydrate(ctx, board, w, mode)
 	if err != nil {
 		return nil, err
 	}
-	if len(results) == 0 {
+	next, prev := w.cursors(limit, backward)
+	return &models.Page{Users: users, NextCursor: next, PrevCursor: prev}, nil
+}
+
+// GetAroundUser - Up to radius players above and below the user
+func (r *CacheRepository) GetAroundUser(ctx context.Context, board string, mode models.RankMode, userID int64, radius int64) ([]models.RankedUser, error) {
+	res, err := r.aroundScript.Run(ctx, r.client,
+		[]string{BoardKey(board)},
+		strconv.FormatInt(userID, 10), radius,
+	).Slice()
+	if err == redis.Nil {
+		return nil, ErrUserNotCached
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.hydrate(ctx, board, parseRankedWindow(res), mode)
+}
+
+// hydrate - Attach usernames, decay flags and ranks to a slice of the sorted set
+func (r *CacheRepository) hydrate(ctx context.Context, board string, w rankedWindow, mode models.RankMode) ([]models.RankedUser, error) {
+	if len(w.entries) == 0 {
 		return []models.RankedUser{}, nil
 	}
 	// Pipeline to get usernames efficiently
 	pipe := r.client.Pipeline()
-	cmds := make([]*redis.MapStringStringCmd, len(results))
-	for i, z := range results {
+	cmds := make([]*redis.SliceCmd, len(w.entries))
+	for i, z := range w.entries {
 		userID := z.Member.(string)
-		cmds[i] = pipe.HGetAll(ctx, UserHashPrefix+userID)
+		cmds[i] = pipe.HMGet(ctx, UserHashPrefix+userID, "username", decayedField(board))
 	}
-	_, err = pipe.Exec(ctx)
-	if err != nil {
+	_, err := pipe.Exec(ctx)
+	if err != nil && err != redis.Nil {
 		return nil, err
 	}
-	// Build result with tie-aware ranking
-	users := make([]models.RankedUser, 0, len(results))
-	var currentRank int64 = offset + 1
-	var prevRating float64 = -1
-	for i, z := range results {
+	ranks := w.ranks(mode)
+	users := make([]models.RankedUser, 0, len(w.entries))
+	for i, z := range w.entries {
 		userID, _ := strconv.ParseInt(z.Member.(string), 10, 64)
-		rating := int(z.Score)
-		data, _ := cmds[i].Result()
-		username := data["username"]
-		// Handle ties - same rating = same rank
-		if float64(rating) != prevRating {
-			currentRank = offset + int64(i) + 1
-			prevRating = float64(rating)
-		}
+		vals := cmds[i].Val()
+		username, _ := vals[0].(string)
 		users = append(users, models.RankedUser{
-			Rank:     currentRank,
+			Rank:     ranks[i],
 			ID:       userID,
 			Username: username,
-			Rating:   rating,
+			Rating:   scoreRating(z.Score),
+			Decayed:  vals[1] != nil,
 		})
 	}
 	return users, nil
 }
 
 // SetUser - Store user in Redis (used during cache warming)
-func (r *CacheRepository) SetUser(ctx context.Context, user models.User) error {
+func (r *CacheRepository) SetUser(ctx context.Context, board string, tieBreak bool, user models.User) error {
 	userIDStr := strconv.FormatInt(user.ID, 10)
 	hashKey := UserHashPrefix + userIDStr
 	pipe := r.client.Pipeline()
 
-	// Add to sorted set
-	pipe.ZAdd(ctx, LeaderboardKey, redis.Z{
-		Score:  float64(user.Rating),
+	// Add to sorted set and its distinct rating index
+	pipe.ZAdd(ctx, BoardKey(board), redis.Z{
+		Score:  compositeScore(user.Rating, user.AchievedAt, tieBreak),
 		Member: userIDStr,
 	})
+	pipe.ZAdd(ctx, ScoresKey(BoardKey(board)), redis.Z{
+		Score:  float64(user.Rating),
+		Member: strconv.Itoa(user.Rating),
+	})
 
 	// Store metadata in hash
 	pipe.HSet(ctx, hashKey, map[string]interface{}{
-		"username": user.Username,
-		"rating":   user.Rating,
-		"version":  user.Version,
+		"username":             user.Username,
+		ratingField(board):     user.Rating,
+		versionField(board):    user.Version,
+		achievedField(board):   achievedSeconds(user.AchievedAt),
+		deviationField(board):  user.Deviation,
+		volatilityField(board): user.Volatility,
 	})
 	_, err := pipe.Exec(ctx)
 	return err
 }
 
-// WarmCache - Load all users from slice into Redis
-func (r *CacheRepository) WarmCache(ctx context.Context, users []models.User) error {
-	pipe := r.client.Pipeline()
+// warmChunkSize - Users per warm-up script call
+const warmChunkSize = 1000
+
+// WarmCache - Load all users of a board from slice into Redis
+// Ratings Redis holds at a newer version win, see warmScript
+func (r *CacheRepository) WarmCache(ctx context.Context, board string, tieBreak bool, users []models.User) error {
+	global := board == "" || board == models.DefaultBoard
+	// Rebuild the distinct rating indexes from scratch, old ratings may be gone
+	indexes := []string{ScoresKey(BoardKey(board))}
+	regions := map[string]bool{}
 	for _, u := range users {
-		userIDStr := strconv.FormatInt(u.ID, 10)
-		hashKey := UserHashPrefix + userIDStr
-		pipe.ZAdd(ctx, LeaderboardKey, redis.Z{
-			Score:  float64(u.Rating),
-			Member: userIDStr,
-		})
-		pipe.HSet(ctx, hashKey, map[string]interface{}{
-			"username": u.Username,
-			"rating":   u.Rating,
-			"version":  u.Version,
-		})
+		if global && u.Region != "" && !regions[u.Region] {
+			regions[u.Region] = true
+			indexes = append(indexes, ScoresKey(RegionKey(u.Region)))
+		}
+	}
+	if err := r.client.Del(ctx, indexes...).Err(); err != nil {
+		return err
+	}
+	for start := 0; start < len(users); start += warmChunkSize {
+		chunk := users[start:min(start+warmChunkSize, len(users))]
+		keys := []string{BoardKey(board)}
+		args := append(fieldArgs(board), deviationField(board), volatilityField(board), tieBreak, global)
+		for _, u := range chunk {
+			userIDStr := strconv.FormatInt(u.ID, 10)
+			keys = append(keys, UserHashPrefix+userIDStr)
+			region := ""
+			if global {
+				region = u.Region
+			}
+			args = append(args, userIDStr, u.Username, u.Rating, u.Version, achievedSeconds(u.AchievedAt),
+				u.Deviation, u.Volatility, u.Decayed, region)
+		}
+		if err := r.warmScript.Run(ctx, r.client, keys, args...).Err(); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// SnapshotBoard - Atomic copy of a board (and its rating index) to key
+func (r *CacheRepository) SnapshotBoard(ctx context.Context, board, key string) error {
+	pipe := r.client.TxPipeline()
+	pipe.Copy(ctx, BoardKey(board), key, 0, true)
+	pipe.Copy(ctx, ScoresKey(BoardKey(board)), ScoresKey(key), 0, true)
 	_, err := pipe.Exec(ctx)
 	return err
 }
 
+// SnapshotExists - Whether a key made by SnapshotBoard is still there
+func (r *CacheRepository) SnapshotExists(ctx context.Context, key string) (bool, error) {
+	n, err := r.client.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+// DeleteSnapshot - Drop a key made by SnapshotBoard
+func (r *CacheRepository) DeleteSnapshot(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key, ScoresKey(key)).Err()
+}
+
+// GetMovers - Players with the biggest summed rating change over window
+// direction is up (gainers) or down (losers)
+func (r *CacheRepository) GetMovers(ctx context.Context, board string, window time.Duration, direction string, limit int64) ([]models.Mover, error) {
+	buckets := moversKeys(board, time.Now(), window)
+	// One cached union per board, window and bucket
+	dest := buckets[0] + ":sum:" + strconv.Itoa(len(buckets))
+	res, err := r.moversScript.Run(ctx, r.client,
+		append([]string{dest}, buckets...),
+		int64(moversCacheTTL/time.Second), direction, limit,
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	movers := make([]models.Mover, 0, len(res)/2)
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.SliceCmd, 0, len(res)/2)
+	for i := 0; i+1 < len(res); i += 2 {
+		userID, _ := strconv.ParseInt(res[i], 10, 64)
+		change, _ := strconv.ParseFloat(res[i+1], 64)
+		movers = append(movers, models.Mover{ID: userID, Change: int(change)})
+		cmds = append(cmds, pipe.HMGet(ctx, UserHashPrefix+res[i], "username", ratingField(board)))
+	}
+	if len(movers) == 0 {
+		return movers, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		vals := cmd.Val()
+		movers[i].Username, _ = vals[0].(string)
+		if v, ok := vals[1].(string); ok {
+			movers[i].Rating, _ = strconv.Atoi(v)
+		}
+	}
+	return movers, nil
+}
+
+// GetPeakRank - Best rank recorded by the write path, 0 if none yet
+func (r *CacheRepository) GetPeakRank(ctx context.Context, board string, userID int64) (int64, error) {
+	peak, err := r.client.HGet(ctx, UserHashPrefix+strconv.FormatInt(userID, 10), peakRankField(board)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return peak, err
+}
+
 // GetTotalUsers - Count in leaderboard
-func (r *CacheRepository) GetTotalUsers(ctx context.Context) (int64, error) {
-	return r.client.ZCard(ctx, LeaderboardKey).Result()
+func (r *CacheRepository) GetTotalUsers(ctx context.Context, key string) (int64, error) {
+	return r.client.ZCard(ctx, key).Result()
+}
+
+// ExpireWindow - Set retention on a closed window, keeps an existing TTL
+func (r *CacheRepository) ExpireWindow(ctx context.Context, key string, retention time.Duration) error {
+	pipe := r.client.Pipeline()
+	pipe.ExpireNX(ctx, key, retention)
+	pipe.ExpireNX(ctx, ScoresKey(key), retention)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
 // FlushAll - Clear Redis (for testing)
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+// ChangesChannel - Pub/sub channel every applied rating write is published on,
+// from inside the write scripts so no path can skip it
+const ChangesChannel = "leaderboard:changes"
+
+// BoardsChannel - Pub/sub channel carrying the ID of every created or changed
+// board, instances drop their cached definition of it
+const BoardsChannel = "leaderboard:boards"
+
+// PublishBoardChange - Announce a created or changed board definition
+func (r *CacheRepository) PublishBoardChange(ctx context.Context, id string) error {
+	return r.client.Publish(ctx, BoardsChannel, id).Err()
+}
+
+// ListenChanges - Call fn for every rating change and boardFn for every board
+// change made by any instance until ctx is done. go-redis resubscribes after a
+// dropped connection, changes published in between are missed.
+func (r *CacheRepository) ListenChanges(ctx context.Context, fn func(models.RatingEvent), boardFn func(string)) error {
+	pubsub := r.client.Subscribe(ctx, ChangesChannel, BoardsChannel)
+	defer pubsub.Close()
+	// Wait for the subscription so no change after this call is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+	ch := pubsub.Channel()
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if msg.Channel == BoardsChannel {
+				boardFn(msg.Payload)
+				continue
+			}
+			var event models.RatingEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				continue // Not published by the write scripts
+			}
+			fn(event)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
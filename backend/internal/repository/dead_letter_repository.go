@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+type DeadLetterRepository struct {
+	db *sqlx.DB
+}
+
+func NewDeadLetterRepository(db *sqlx.DB) *DeadLetterRepository {
+	return &DeadLetterRepository{db: db}
+}
+
+// IsTransient - Whether a failed write is worth retrying as is. Anything that
+// is not an error reported by Postgres (network, timeout, cancel) is, as are
+// connection, rollback, resource and shutdown errors. The rest is about the
+// rows themselves.
+func IsTransient(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return true
+	}
+	switch pqErr.Code.Class() {
+	case "08", "40", "53", "57", "58":
+		return true
+	}
+	return false
+}
+
+// Add - Park an update that cannot be written
+func (r *DeadLetterRepository) Add(ctx context.Context, update models.RatingUpdate, reason string) error {
+	payload, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	board := update.BoardID
+	if board == "" {
+		board = models.DefaultBoard
+	}
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO dead_letters (board_id, user_id, payload, error) VALUES ($1, $2, $3, $4)",
+		board, update.UserID, payload, reason)
+	return err
+}
+
+// List - Oldest first, keyset paged by id
+func (r *DeadLetterRepository) List(ctx context.Context, afterID int64, limit int) ([]models.DeadLetter, error) {
+	letters := []models.DeadLetter{}
+	err := r.db.SelectContext(ctx, &letters,
+		`SELECT id, board_id, user_id, payload, error, failed_at FROM dead_letters
+		WHERE id > $1 ORDER BY id LIMIT $2`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range letters {
+		if err := json.Unmarshal(letters[i].Payload, &letters[i].Update); err != nil {
+			return nil, err
+		}
+	}
+	return letters, nil
+}
+
+// Get - Single dead letter by ID
+func (r *DeadLetterRepository) Get(ctx context.Context, id int64) (*models.DeadLetter, error) {
+	var letter models.DeadLetter
+	err := r.db.GetContext(ctx, &letter,
+		"SELECT id, board_id, user_id, payload, error, failed_at FROM dead_letters WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(letter.Payload, &letter.Update); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// Count - Dead letters waiting
+func (r *DeadLetterRepository) Count(ctx context.Context) (int64, error) {
+	var n int64
+	err := r.db.GetContext(ctx, &n, "SELECT COUNT(*) FROM dead_letters")
+	return n, err
+}
+
+// Delete - Drop a dead letter, ErrDeadLetterNotFound if it is gone already
+func (r *DeadLetterRepository) Delete(ctx context.Context, id int64) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM dead_letters WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// DeleteMany - Drop dead letters by ID, missing ones are ignored
+func (r *DeadLetterRepository) DeleteMany(ctx context.Context, ids []int64) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM dead_letters WHERE id = ANY($1)", pq.Array(ids))
+	return err
+}
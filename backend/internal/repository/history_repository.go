@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+// MaxHistoryPoints - Upper bound for one history read, the earliest points win
+const MaxHistoryPoints = 5000
+
+type HistoryRepository struct {
+	db *sqlx.DB
+}
+
+func NewHistoryRepository(db *sqlx.DB) *HistoryRepository {
+	return &HistoryRepository{db: db}
+}
+
+// GetHistory - Rating changes of a user on a board in [from, to], oldest first
+func (r *HistoryRepository) GetHistory(ctx context.Context, boardID string, userID int64, from, to time.Time) ([]models.RatingChange, error) {
+	changes := []models.RatingChange{}
+	err := r.db.SelectContext(ctx, &changes,
+		`SELECT old_rating, new_rating, version, source, recorded_at FROM rating_history
+		WHERE board_id = $1 AND user_id = $2 AND recorded_at BETWEEN $3 AND $4
+		ORDER BY recorded_at, version LIMIT $5`,
+		boardID, userID, from, to, MaxHistoryPoints)
+	return changes, err
+}
+
+// GetPeakRating - Highest rating a user ever had on a board, 0 without history
+func (r *HistoryRepository) GetPeakRating(ctx context.Context, boardID string, userID int64) (int, error) {
+	var peak int
+	err := r.db.GetContext(ctx, &peak,
+		"SELECT COALESCE(MAX(new_rating), 0) FROM rating_history WHERE board_id = $1 AND user_id = $2",
+		boardID, userID)
+	return peak, err
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+// Every ranked sorted set has a companion set of its distinct ratings
+// (member = score = rating). Dense rank is a ZCOUNT on that set, so all
+// three rank modes stay O(log N).
+
+// Boards with tie-breaking store rating + (1 - achievedAt/2^32) as score, so
+// among equal ratings the earliest achievement sorts first. The integer part
+// is always the rating, which is what every rank mode counts on.
+const tieBreakScale = 1 << 32
+
+// setScoreLua - Lua helpers that move or remove a member and keep the distinct
+// index in sync
+const setScoreLua = `
+local function setScore(key, member, score, rating)
+    local old = redis.call('ZSCORE', key, member)
+    redis.call('ZADD', key, score, member)
+    redis.call('ZADD', key .. ':scores', rating, rating)
+    if old then
+        local oldRating = math.floor(tonumber(old))
+        if oldRating ~= tonumber(rating) and redis.call('ZCOUNT', key, oldRating, '(' .. (oldRating + 1)) == 0 then
+            redis.call('ZREM', key .. ':scores', oldRating)
+        end
+    end
+end
+
+local function removeScore(key, member)
+    local old = redis.call('ZSCORE', key, member)
+    if old then
+        redis.call('ZREM', key, member)
+        local oldRating = math.floor(tonumber(old))
+        if redis.call('ZCOUNT', key, oldRating, '(' .. (oldRating + 1)) == 0 then
+            redis.call('ZREM', key .. ':scores', oldRating)
+        end
+    end
+end
+`
+
+// rankWindowLua - Lua helper returning a slice of the board plus the counts
+// needed to rank its first entry in every mode
+const rankWindowLua = `
+local function rankWindow(key, start, stop)
+    local window = redis.call('ZREVRANGE', key, start, stop, 'WITHSCORES')
+    if #window == 0 then
+        return {start, 0, 0, window}
+    end
+    local floor = math.floor(tonumber(window[2])) + 1
+    local above = redis.call('ZCOUNT', key, floor, '+inf')
+    local distinct = redis.call('ZCOUNT', key .. ':scores', floor, '+inf')
+    return {start, above, distinct, window}
+end
+`
+
+// cursorWindowLua - Lua script for an ATOMIC keyset page read.
+// pos is where the cursor entry sorts: its rank if it still has the cursor
+// score, otherwise the number of entries ahead of it (exclusive bounds)
+const cursorWindowLua = rankWindowLua + `
+local pos
+local after = 0
+local score = redis.call('ZSCORE', KEYS[1], ARGV[2])
+if score and tonumber(score) == tonumber(ARGV[1]) then
+    pos = redis.call('ZREVRANK', KEYS[1], ARGV[2])
+    after = 1
+else
+    -- Cursor entry moved, skip past everything that sorted before it
+    pos = redis.call('ZCOUNT', KEYS[1], '(' .. ARGV[1], '+inf')
+    for _, m in ipairs(redis.call('ZREVRANGEBYSCORE', KEYS[1], ARGV[1], ARGV[1])) do
+        if m > ARGV[2] then
+            pos = pos + 1
+        end
+    end
+end
+local limit = tonumber(ARGV[4])
+if ARGV[3] == '1' then
+    if pos == 0 then
+        return {0, 0, 0, {}}
+    end
+    return rankWindow(KEYS[1], math.max(pos - limit, 0), pos - 1)
+end
+return rankWindow(KEYS[1], pos + after, pos + after + limit - 1)
+`
+
+// Lua script for an ATOMIC single rank read in every mode
+const rankScript = `
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score then
+    return false
+end
+local floor = math.floor(tonumber(score)) + 1
+local above = redis.call('ZCOUNT', KEYS[1], floor, '+inf')
+local distinct = redis.call('ZCOUNT', KEYS[1] .. ':scores', floor, '+inf')
+local pos = redis.call('ZREVRANK', KEYS[1], ARGV[1])
+local decayed = redis.call('HEXISTS', KEYS[2], ARGV[2])
+-- Regional counts, only the global board has regions
+local region = ''
+local rAbove, rDistinct, rPos = 0, 0, 0
+if ARGV[3] == '1' then
+    region = redis.call('HGET', KEYS[2], 'region') or ''
+    if region ~= '' then
+        local rkey = 'leaderboard:region:' .. region .. ':zset'
+        rAbove = redis.call('ZCOUNT', rkey, floor, '+inf')
+        rDistinct = redis.call('ZCOUNT', rkey .. ':scores', floor, '+inf')
+        rPos = redis.call('ZREVRANK', rkey, ARGV[1]) or 0
+    end
+end
+return {score, above, distinct, pos, decayed, region, rAbove, rDistinct, rPos}
+`
+
+// ScoresKey - Distinct rating index of a sorted set
+func ScoresKey(key string) string {
+	return key + ":scores"
+}
+
+// rankedWindow - Decoded reply of rankWindow
+type rankedWindow struct {
+	start    int64 // position of entries[0]
+	above    int64 // players strictly above entries[0]
+	distinct int64 // distinct ratings strictly above entries[0]
+	entries  []redis.Z
+}
+
+func parseRankedWindow(res []interface{}) rankedWindow {
+	w := rankedWindow{
+		start:    res[0].(int64),
+		above:    res[1].(int64),
+		distinct: res[2].(int64),
+	}
+	raw := res[3].([]interface{})
+	w.entries = make([]redis.Z, 0, len(raw)/2)
+	for i := 0; i+1 < len(raw); i += 2 {
+		score, _ := strconv.ParseFloat(raw[i+1].(string), 64)
+		w.entries = append(w.entries, redis.Z{Member: raw[i], Score: score})
+	}
+	return w
+}
+
+// ranks - Rank of every entry in the window under the given mode
+func (w rankedWindow) ranks(mode models.RankMode) []int64 {
+	ranks := make([]int64, len(w.entries))
+	var rank int64
+	for i, z := range w.entries {
+		switch {
+		case mode == models.RankOrdinal:
+			rank = w.start + int64(i) + 1
+		case i == 0 && mode == models.RankDense:
+			rank = w.distinct + 1
+		case i == 0:
+			rank = w.above + 1
+		case scoreRating(z.Score) == scoreRating(w.entries[i-1].Score):
+			// Tie - same rank as previous entry
+		case mode == models.RankDense:
+			rank++
+		default:
+			rank = w.start + int64(i) + 1
+		}
+		ranks[i] = rank
+	}
+	return ranks
+}
+
+// cursors - Cursors to the pages after and before this window
+// limit is the requested page size, a short forward window means the end was
+// reached; a backward window always has the cursor entry after it
+func (w rankedWindow) cursors(limit int64, backward bool) (next, prev string) {
+	if len(w.entries) == 0 {
+		return "", ""
+	}
+	if backward || int64(len(w.entries)) == limit {
+		last := w.entries[len(w.entries)-1]
+		next = models.Cursor{Score: formatScore(last.Score), Member: last.Member.(string)}.Encode()
+	}
+	if w.start > 0 {
+		first := w.entries[0]
+		prev = models.Cursor{Score: formatScore(first.Score), Member: first.Member.(string), Prev: true}.Encode()
+	}
+	return next, prev
+}
+
+// formatScore - Shortest form that parses back to the exact same score
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// rankFor - Rank of a single member from a rankScript reply
+func rankFor(mode models.RankMode, above, distinct, pos int64) int64 {
+	switch mode {
+	case models.RankDense:
+		return distinct + 1
+	case models.RankOrdinal:
+		return pos + 1
+	}
+	return above + 1
+}
+
+// compositeScore - Sorted set score for a rating, see tieBreakScale
+func compositeScore(rating int, achievedAt time.Time, tieBreak bool) float64 {
+	if !tieBreak {
+		return float64(rating)
+	}
+	return float64(rating) + 1 - float64(achievedSeconds(achievedAt))/tieBreakScale
+}
+
+// achievedSeconds - Unix seconds, kept positive so the fraction stays below 1
+func achievedSeconds(t time.Time) int64 {
+	if sec := t.Unix(); sec > 0 {
+		return sec
+	}
+	return 1
+}
+
+// scoreRating - Integer rating stored in a sorted set score
+func scoreRating(score float64) int {
+	return int(score)
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+// GetStoredRatings - Rating, version, achievement time and decay flag of each
+// user on a board as Redis has them, nil where Redis has no rating
+func (r *CacheRepository) GetStoredRatings(ctx context.Context, board string, userIDs []int64) ([]*models.User, error) {
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(userIDs))
+	for i, id := range userIDs {
+		cmds[i] = pipe.HMGet(ctx, UserHashPrefix+strconv.FormatInt(id, 10),
+			ratingField(board), versionField(board), achievedField(board), decayedField(board))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	stored := make([]*models.User, len(userIDs))
+	for i, cmd := range cmds {
+		vals := cmd.Val()
+		rating, ok := vals[0].(string)
+		if !ok {
+			continue
+		}
+		u := &models.User{ID: userIDs[i]}
+		u.Rating, _ = strconv.Atoi(rating)
+		if v, ok := vals[1].(string); ok {
+			u.Version, _ = strconv.ParseInt(v, 10, 64)
+		}
+		if v, ok := vals[2].(string); ok {
+			sec, _ := strconv.ParseFloat(v, 64)
+			u.AchievedAt = time.Unix(int64(sec), 0)
+		}
+		u.Decayed = vals[3] != nil
+		stored[i] = u
+	}
+	return stored, nil
+}
+
+// RepairRating - Versioned write of a rating restored from Postgres. Counts as
+// bookkeeping: no activity, no time-windowed boards. Returns false if Redis
+// already has this version or a newer one.
+func (r *CacheRepository) RepairRating(ctx context.Context, board string, tieBreak bool, u models.User) (bool, error) {
+	userIDStr := strconv.FormatInt(u.ID, 10)
+	hashKey := UserHashPrefix + userIDStr
+	// The script keeps what it does not know about, fill gaps of a lost hash
+	pipe := r.client.Pipeline()
+	pipe.HSetNX(ctx, hashKey, "username", u.Username)
+	if u.Region != "" && (board == "" || board == models.DefaultBoard) {
+		pipe.HSetNX(ctx, hashKey, "region", u.Region)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	res, err := r.updateScript.Run(ctx, r.client,
+		[]string{BoardKey(board), hashKey},
+		append(fieldArgs(board), userIDStr, u.Rating, u.Version, achievedSeconds(u.AchievedAt), tieBreak, "", "")...,
+	).Slice()
+	if err != nil {
+		return false, err
+	}
+	if _, err := updateResult(u.ID, res); err != nil {
+		if errors.Is(err, ErrStaleUpdate) {
+			return false, nil
+		}
+		return false, err
+	}
+	if u.Decayed {
+		if err := r.client.HSet(ctx, hashKey, decayedField(board), "1").Err(); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// ScanBoard - One ZSCAN step over the members of a board, cursor 0 starts
+// and a returned cursor of 0 means done
+func (r *CacheRepository) ScanBoard(ctx context.Context, board string, cursor uint64, count int64) ([]int64, uint64, error) {
+	pairs, next, err := r.client.ZScan(ctx, BoardKey(board), cursor, "", count).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]int64, 0, len(pairs)/2)
+	// Member, score, member, score...
+	for i := 0; i < len(pairs); i += 2 {
+		if id, err := strconv.ParseInt(pairs[i], 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, next, nil
+}
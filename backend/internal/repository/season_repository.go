@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+var ErrSeasonNotFound = errors.New("season not found")
+
+const seasonColumns = "id, board_id, name, status, reset_factor, reset_target, reset_version, started_at, ended_at"
+
+type SeasonRepository struct {
+	db *sqlx.DB
+}
+
+func NewSeasonRepository(db *sqlx.DB) *SeasonRepository {
+	return &SeasonRepository{db: db}
+}
+
+// CreateSeason - Start a new active season
+func (r *SeasonRepository) CreateSeason(ctx context.Context, boardID, name string) (*models.Season, error) {
+	var season models.Season
+	err := r.db.GetContext(ctx, &season,
+		"INSERT INTO seasons (board_id, name) VALUES ($1, $2) RETURNING "+seasonColumns,
+		boardID, name)
+	if err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// GetSeason - Single season by ID
+func (r *SeasonRepository) GetSeason(ctx context.Context, id int64) (*models.Season, error) {
+	var season models.Season
+	err := r.db.GetContext(ctx, &season,
+		"SELECT "+seasonColumns+" FROM seasons WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrSeasonNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// GetSeasons - All seasons of a board, newest first
+func (r *SeasonRepository) GetSeasons(ctx context.Context, boardID string) ([]models.Season, error) {
+	seasons := []models.Season{}
+	err := r.db.SelectContext(ctx, &seasons,
+		"SELECT "+seasonColumns+" FROM seasons WHERE board_id = $1 ORDER BY id DESC", boardID)
+	return seasons, err
+}
+
+// EndSeason - Move an active season to archiving, false if it was not active
+// The caller holds the archive lease for the given duration
+func (r *SeasonRepository) EndSeason(ctx context.Context, id int64, resetFactor float64, resetTarget int, lease time.Duration) (*models.Season, error) {
+	var season models.Season
+	err := r.db.GetContext(ctx, &season,
+		`UPDATE seasons SET status = $2, reset_factor = $3, reset_target = $4, ended_at = NOW(),
+		archive_lease = NOW() + $6 * INTERVAL '1 second'
+		WHERE id = $1 AND status = $5 RETURNING `+seasonColumns,
+		id, models.SeasonArchiving, resetFactor, resetTarget, models.SeasonActive, lease.Seconds())
+	if err == sql.ErrNoRows {
+		return nil, ErrSeasonNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// ClaimArchiving - Take over archiving seasons whose lease ran out, e.g.
+// because the instance running them stopped
+func (r *SeasonRepository) ClaimArchiving(ctx context.Context, lease time.Duration) ([]models.Season, error) {
+	seasons := []models.Season{}
+	err := r.db.SelectContext(ctx, &seasons,
+		`UPDATE seasons SET archive_lease = NOW() + $2 * INTERVAL '1 second'
+		WHERE status = $1 AND (archive_lease IS NULL OR archive_lease < NOW()) RETURNING `+seasonColumns,
+		models.SeasonArchiving, lease.Seconds())
+	return seasons, err
+}
+
+// RenewLease - Keep the archive lease while archiving makes progress
+func (r *SeasonRepository) RenewLease(ctx context.Context, id int64, lease time.Duration) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE seasons SET archive_lease = NOW() + $2 * INTERVAL '1 second' WHERE id = $1", id, lease.Seconds())
+	return err
+}
+
+// SetResetVersion - Record the version the soft reset is written with
+func (r *SeasonRepository) SetResetVersion(ctx context.Context, id, version int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE seasons SET reset_version = $2 WHERE id = $1", id, version)
+	return err
+}
+
+// SetStatus - Record the outcome of archiving. Only the first run to finish
+// does, a run that took over from a slow one may still fail afterwards.
+func (r *SeasonRepository) SetStatus(ctx context.Context, id int64, status string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE seasons SET status = $2, archive_lease = NULL WHERE id = $1 AND status = $3",
+		id, status, models.SeasonArchiving)
+	return err
+}
+
+// InsertStandings - Archive one chunk of final standings
+// offset is the position of users[0] on the final board
+func (r *SeasonRepository) InsertStandings(ctx context.Context, seasonID, offset int64, users []models.RankedUser) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO season_standings (season_id, position, rank, user_id, username, rating)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (season_id, position) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, u := range users {
+		_, err = stmt.ExecContext(ctx, seasonID, offset+int64(i), u.Rank, u.ID, u.Username, u.Rating)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetStandings - Offset page of an archived season
+func (r *SeasonRepository) GetStandings(ctx context.Context, seasonID, limit, offset int64) ([]models.Standing, error) {
+	rows := []models.Standing{}
+	err := r.db.SelectContext(ctx, &rows,
+		`SELECT position, rank, user_id AS id, username, rating FROM season_standings
+		WHERE season_id = $1 ORDER BY position LIMIT $2 OFFSET $3`,
+		seasonID, limit, offset)
+	return rows, err
+}
+
+// GetStandingsAfter - Keyset page after (or before) a position
+func (r *SeasonRepository) GetStandingsAfter(ctx context.Context, seasonID, position, limit int64, backward bool) ([]models.Standing, error) {
+	rows := []models.Standing{}
+	if !backward {
+		err := r.db.SelectContext(ctx, &rows,
+			`SELECT position, rank, user_id AS id, username, rating FROM season_standings
+			WHERE season_id = $1 AND position > $2 ORDER BY position LIMIT $3`,
+			seasonID, position, limit)
+		return rows, err
+	}
+	err := r.db.SelectContext(ctx, &rows,
+		`SELECT * FROM (SELECT position, rank, user_id AS id, username, rating FROM season_standings
+		WHERE season_id = $1 AND position < $2 ORDER BY position DESC LIMIT $3) page ORDER BY position`,
+		seasonID, position, limit)
+	return rows, err
+}
+
+// CountStandings - Number of archived players
+func (r *SeasonRepository) CountStandings(ctx context.Context, seasonID int64) (int64, error) {
+	var count int64
+	err := r.db.GetContext(ctx, &count,
+		"SELECT COUNT(*) FROM season_standings WHERE season_id = $1", seasonID)
+	return count, err
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+var ErrNotRanked = errors.New("user was not ranked at that time")
+
+// snapshotSlack - History rows written this long before a snapshot are
+// replayed too. A row is logged when its transaction starts, a DB writer
+// batch can commit it after the snapshot was taken. Queue lag does not
+// matter, rows are picked by when they were written, not when the update was
+// made.
+const snapshotSlack = time.Minute
+
+// stateAtCTE - Ratings of a board at $3: the snapshot $4 overlaid with the
+// latest history row per user made by $3 and written after $2. $1 is the board
+const stateAtCTE = `WITH latest AS (
+	SELECT DISTINCT ON (user_id) user_id, new_rating AS rating FROM rating_history
+	WHERE board_id = $1 AND logged_at > $2 AND recorded_at <= $3
+	ORDER BY user_id, recorded_at DESC, version DESC
+), state AS (
+	SELECT COALESCE(l.user_id, e.user_id) AS user_id, COALESCE(l.rating, e.rating) AS rating
+	FROM (SELECT user_id, rating FROM snapshot_entries WHERE snapshot_id = $4) e
+	FULL OUTER JOIN latest l ON l.user_id = e.user_id
+)`
+
+// rankedCTE - stateAtCTE plus ranks in the board's mode
+// Historical ranks ignore the tie-break, it is not kept in the history
+func rankedCTE(mode models.RankMode) string {
+	fn := "RANK() OVER (ORDER BY rating DESC)"
+	switch mode {
+	case models.RankDense:
+		fn = "DENSE_RANK() OVER (ORDER BY rating DESC)"
+	case models.RankOrdinal:
+		fn = "ROW_NUMBER() OVER (ORDER BY rating DESC, user_id)"
+	}
+	return stateAtCTE + `, ranked AS (
+	SELECT user_id, rating, ` + fn + ` AS rank FROM state
+)`
+}
+
+type SnapshotRepository struct {
+	db *sqlx.DB
+}
+
+func NewSnapshotRepository(db *sqlx.DB) *SnapshotRepository {
+	return &SnapshotRepository{db: db}
+}
+
+// CreateSnapshot - Copy every current rating of a board in one transaction
+func (r *SnapshotRepository) CreateSnapshot(ctx context.Context, boardID string) (*models.Snapshot, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var snapshot models.Snapshot
+	err = tx.GetContext(ctx, &snapshot,
+		"INSERT INTO leaderboard_snapshots (board_id) VALUES ($1) RETURNING id, board_id, taken_at", boardID)
+	if err != nil {
+		return nil, err
+	}
+	if boardID == models.DefaultBoard {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO snapshot_entries (snapshot_id, user_id, rating) SELECT $1, id, rating FROM users",
+			snapshot.ID)
+	} else {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO snapshot_entries (snapshot_id, user_id, rating) SELECT $1, user_id, rating FROM board_ratings WHERE board_id = $2",
+			snapshot.ID, boardID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, tx.Commit()
+}
+
+// LatestSnapshot - Newest snapshot of a board taken at or before at, nil if none
+func (r *SnapshotRepository) LatestSnapshot(ctx context.Context, boardID string, at time.Time) (*models.Snapshot, error) {
+	var snapshot models.Snapshot
+	err := r.db.GetContext(ctx, &snapshot,
+		`SELECT id, board_id, taken_at FROM leaderboard_snapshots
+		WHERE board_id = $1 AND taken_at <= $2 ORDER BY taken_at DESC LIMIT 1`,
+		boardID, at)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// DeleteSnapshotsBefore - Drop old snapshots (entries cascade)
+func (r *SnapshotRepository) DeleteSnapshotsBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM leaderboard_snapshots WHERE taken_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// stateArgs - Arguments of stateAtCTE. History alone misses every player
+// without a row, so there is always a snapshot
+func stateArgs(boardID string, snapshot *models.Snapshot, at time.Time) []interface{} {
+	return []interface{}{boardID, snapshot.TakenAt.Add(-snapshotSlack), at, snapshot.ID}
+}
+
+// GetLeaderboardAt - Offset page of the board as it was at at, plus its size
+func (r *SnapshotRepository) GetLeaderboardAt(ctx context.Context, boardID string, snapshot *models.Snapshot, at time.Time, mode models.RankMode, limit, offset int64) ([]models.RankedUser, int64, error) {
+	users := []models.RankedUser{}
+	args := stateArgs(boardID, snapshot, at)
+	err := r.db.SelectContext(ctx, &users,
+		rankedCTE(mode)+`
+		SELECT r.rank, r.user_id AS id, u.username, r.rating FROM ranked r JOIN users u ON u.id = r.user_id
+		ORDER BY r.rank, r.user_id LIMIT $5 OFFSET $6`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	err = r.db.GetContext(ctx, &total, stateAtCTE+" SELECT COUNT(*) FROM state", args...)
+	return users, total, err
+}
+
+// GetRankAt - Rank of a user on the board as it was at at
+func (r *SnapshotRepository) GetRankAt(ctx context.Context, boardID string, snapshot *models.Snapshot, at time.Time, mode models.RankMode, userID int64) (*models.RankedUser, error) {
+	var user models.RankedUser
+	err := r.db.GetContext(ctx, &user,
+		rankedCTE(mode)+`
+		SELECT r.rank, r.user_id AS id, u.username, r.rating FROM ranked r JOIN users u ON u.id = r.user_id
+		WHERE r.user_id = $5`,
+		append(stateArgs(boardID, snapshot, at), userID)...)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotRanked
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+var ErrAlreadyInTeam = errors.New("user is already in a team")
+
+const (
+	TeamsKey      = "teams:zset" // Sorted set of team scores
+	TeamKeyPrefix = "team:"      // team:<id> hash (name, aggregate), team:<id>:members sorted set
+)
+
+// teamLua - Lua helpers keeping team scores in step with member ratings.
+// The user hash "team" field links a player to their team, every team holds
+// its members' global ratings in a sorted set, so a score is recomputed from
+// at most MaxTeamSize entries
+const teamLua = `
+local function refreshTeam(team)
+    local meta = 'team:' .. team
+    local members = meta .. ':members'
+    local n = redis.call('ZCARD', members)
+    if n == 0 then
+        redis.call('ZREM', 'teams:zset', team)
+        return
+    end
+    local agg = redis.call('HGET', meta, 'aggregate')
+    local score = 0
+    if agg == 'median' then
+        local mid = redis.call('ZRANGE', members, math.floor((n - 1) / 2), math.floor(n / 2), 'WITHSCORES')
+        score = (tonumber(mid[2]) + tonumber(mid[#mid])) / 2
+    else
+        local stop = 4
+        if agg == 'sum' then
+            stop = -1
+        end
+        local top = redis.call('ZREVRANGE', members, 0, stop, 'WITHSCORES')
+        for i = 2, #top, 2 do
+            score = score + tonumber(top[i])
+        end
+        if agg ~= 'sum' then
+            score = score / (#top / 2)
+        end
+    end
+    redis.call('ZADD', 'teams:zset', score, team)
+end
+
+local function updateTeam(hashKey, member, rating)
+    local team = redis.call('HGET', hashKey, 'team')
+    if team then
+        redis.call('ZADD', 'team:' .. team .. ':members', rating, member)
+        refreshTeam(team)
+    end
+end
+`
+
+// Lua script for joining a team. KEYS: user hash. ARGV: team, member,
+// default rating. Returns 1, 0 when in another team, -1 for an unknown user
+const joinTeamScript = teamLua + `
+if redis.call('HEXISTS', KEYS[1], 'username') == 0 then
+    return -1
+end
+local current = redis.call('HGET', KEYS[1], 'team')
+if current and current ~= ARGV[1] then
+    return 0
+end
+redis.call('HSET', KEYS[1], 'team', ARGV[1])
+local rating = redis.call('HGET', KEYS[1], 'rating') or ARGV[3]
+redis.call('ZADD', 'team:' .. ARGV[1] .. ':members', rating, ARGV[2])
+refreshTeam(ARGV[1])
+return 1
+`
+
+// Lua script for leaving a team. KEYS: user hash. ARGV: team, member
+const leaveTeamScript = teamLua + `
+if redis.call('HGET', KEYS[1], 'team') == ARGV[1] then
+    redis.call('HDEL', KEYS[1], 'team')
+end
+redis.call('ZREM', 'team:' .. ARGV[1] .. ':members', ARGV[2])
+refreshTeam(ARGV[1])
+return 1
+`
+
+// Lua script for (re)building a team. ARGV: team, name, aggregate, members...
+const setTeamScript = teamLua + `
+local meta = 'team:' .. ARGV[1]
+redis.call('HSET', meta, 'name', ARGV[2], 'aggregate', ARGV[3])
+redis.call('DEL', meta .. ':members')
+for i = 4, #ARGV do
+    local hashKey = 'user:hash:' .. ARGV[i]
+    if redis.call('HEXISTS', hashKey, 'username') == 1 then
+        redis.call('HSET', hashKey, 'team', ARGV[1])
+        redis.call('ZADD', meta .. ':members', redis.call('HGET', hashKey, 'rating') or 1000, ARGV[i])
+    end
+end
+refreshTeam(ARGV[1])
+return 1
+`
+
+// teamKey - Metadata hash of a team
+func teamKey(teamID int64) string {
+	return TeamKeyPrefix + strconv.FormatInt(teamID, 10)
+}
+
+// JoinTeam - Link a cached user to a team and rescore it
+func (r *CacheRepository) JoinTeam(ctx context.Context, teamID, userID int64) error {
+	userIDStr := strconv.FormatInt(userID, 10)
+	res, err := r.joinTeamScript.Run(ctx, r.client,
+		[]string{UserHashPrefix + userIDStr},
+		teamID, userIDStr, models.DefaultRating,
+	).Int()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 0:
+		return ErrAlreadyInTeam
+	case -1:
+		return ErrUserNotCached
+	}
+	return nil
+}
+
+// LeaveTeam - Unlink a user from a team and rescore it
+func (r *CacheRepository) LeaveTeam(ctx context.Context, teamID, userID int64) error {
+	userIDStr := strconv.FormatInt(userID, 10)
+	return r.leaveTeamScript.Run(ctx, r.client,
+		[]string{UserHashPrefix + userIDStr},
+		teamID, userIDStr,
+	).Err()
+}
+
+// SetTeam - Store a team with its members and rescore it
+// Used for new teams, aggregate changes and cache warming
+func (r *CacheRepository) SetTeam(ctx context.Context, team models.Team, memberIDs []int64) error {
+	args := []interface{}{team.ID, team.Name, string(team.Aggregate)}
+	for _, id := range memberIDs {
+		args = append(args, id)
+	}
+	return r.setTeamScript.Run(ctx, r.client, []string{teamKey(team.ID)}, args...).Err()
+}
+
+// ClearTeams - Drop the team ranking before a rebuild
+func (r *CacheRepository) ClearTeams(ctx context.Context) error {
+	return r.client.Del(ctx, TeamsKey).Err()
+}
+
+// GetTeamLeaderboard - Offset page of teams with competition ranks
+func (r *CacheRepository) GetTeamLeaderboard(ctx context.Context, limit, offset int64) ([]models.RankedTeam, int64, error) {
+	entries, err := r.client.ZRevRangeWithScores(ctx, TeamsKey, offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := r.client.ZCard(ctx, TeamsKey).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	teams := make([]models.RankedTeam, 0, len(entries))
+	if len(entries) == 0 {
+		return teams, total, nil
+	}
+	// Teams strictly above the first entry, ranks follow from there
+	above, err := r.client.ZCount(ctx, TeamsKey, "("+formatScore(entries[0].Score), "+inf").Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	pipe := r.client.Pipeline()
+	names := make([]*redis.StringCmd, len(entries))
+	sizes := make([]*redis.IntCmd, len(entries))
+	for i, z := range entries {
+		id := z.Member.(string)
+		names[i] = pipe.HGet(ctx, TeamKeyPrefix+id, "name")
+		sizes[i] = pipe.ZCard(ctx, TeamKeyPrefix+id+":members")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, 0, err
+	}
+	rank := above + 1
+	for i, z := range entries {
+		if i > 0 && z.Score != entries[i-1].Score {
+			rank = offset + int64(i) + 1
+		}
+		id, _ := strconv.ParseInt(z.Member.(string), 10, 64)
+		teams = append(teams, models.RankedTeam{
+			Rank:    rank,
+			ID:      id,
+			Name:    names[i].Val(),
+			Score:   z.Score,
+			Members: sizes[i].Val(),
+		})
+	}
+	return teams, total, nil
+}
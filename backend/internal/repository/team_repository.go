@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+var ErrTeamNotFound = errors.New("team not found")
+
+type TeamRepository struct {
+	db *sqlx.DB
+}
+
+func NewTeamRepository(db *sqlx.DB) *TeamRepository {
+	return &TeamRepository{db: db}
+}
+
+// GetTeams - All teams, oldest first
+func (r *TeamRepository) GetTeams(ctx context.Context) ([]models.Team, error) {
+	teams := []models.Team{}
+	err := r.db.SelectContext(ctx, &teams,
+		"SELECT id, name, aggregate, created_at FROM teams ORDER BY id")
+	return teams, err
+}
+
+// GetTeam - Single team by ID
+func (r *TeamRepository) GetTeam(ctx context.Context, id int64) (*models.Team, error) {
+	var team models.Team
+	err := r.db.GetContext(ctx, &team,
+		"SELECT id, name, aggregate, created_at FROM teams WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrTeamNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+// CreateTeam - New empty team, false if the name is taken
+func (r *TeamRepository) CreateTeam(ctx context.Context, name string, aggregate models.TeamAggregate) (*models.Team, bool, error) {
+	var team models.Team
+	err := r.db.GetContext(ctx, &team,
+		`INSERT INTO teams (name, aggregate) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING
+		RETURNING id, name, aggregate, created_at`,
+		name, aggregate)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &team, true, nil
+}
+
+// UpdateAggregate - Switch how a team is scored
+func (r *TeamRepository) UpdateAggregate(ctx context.Context, id int64, aggregate models.TeamAggregate) (*models.Team, error) {
+	var team models.Team
+	err := r.db.GetContext(ctx, &team,
+		"UPDATE teams SET aggregate = $2 WHERE id = $1 RETURNING id, name, aggregate, created_at",
+		id, aggregate)
+	if err == sql.ErrNoRows {
+		return nil, ErrTeamNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+// AddMember - Join a team unless full, false if full or the user is in a
+// team already. The team row is locked so concurrent joins see each other
+// in the size check.
+func (r *TeamRepository) AddMember(ctx context.Context, teamID, userID int64, maxSize int) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var id int64
+	err = tx.GetContext(ctx, &id, "SELECT id FROM teams WHERE id = $1 FOR UPDATE", teamID)
+	if err == sql.ErrNoRows {
+		return false, ErrTeamNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO team_members (team_id, user_id)
+		SELECT $1, $2 WHERE (SELECT COUNT(*) FROM team_members WHERE team_id = $1) < $3
+		ON CONFLICT (user_id) DO NOTHING`,
+		teamID, userID, maxSize)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, tx.Commit()
+}
+
+// RemoveMember - Leave a team, false if the user was not a member
+func (r *TeamRepository) RemoveMember(ctx context.Context, teamID, userID int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		"DELETE FROM team_members WHERE team_id = $1 AND user_id = $2", teamID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// GetTeamOf - Team ID of a user, 0 if none
+func (r *TeamRepository) GetTeamOf(ctx context.Context, userID int64) (int64, error) {
+	var teamID int64
+	err := r.db.GetContext(ctx, &teamID,
+		"SELECT team_id FROM team_members WHERE user_id = $1", userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return teamID, err
+}
+
+// GetMemberIDs - Members of a team
+func (r *TeamRepository) GetMemberIDs(ctx context.Context, teamID int64) ([]int64, error) {
+	var ids []int64
+	err := r.db.SelectContext(ctx, &ids,
+		"SELECT user_id FROM team_members WHERE team_id = $1 ORDER BY user_id", teamID)
+	return ids, err
+}
+
+// GetMemberships - Every membership, used for cache warming
+func (r *TeamRepository) GetMemberships(ctx context.Context) ([]models.TeamMembership, error) {
+	var rows []models.TeamMembership
+	err := r.db.SelectContext(ctx, &rows,
+		"SELECT team_id, user_id FROM team_members ORDER BY team_id, user_id")
+	return rows, err
+}
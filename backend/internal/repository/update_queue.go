@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+// Redis stream every applied update goes through on its way to Postgres
+const (
+	UpdateStreamKey = "leaderboard:updates"
+	updateGroup     = "db-writer"
+	updateField     = "u" // JSON encoded models.RatingUpdate
+)
+
+// QueuedUpdate - A stream entry, ack it by ID once it is in Postgres
+type QueuedUpdate struct {
+	ID     string
+	Update models.RatingUpdate
+}
+
+// UpdateQueue - Durable at-least-once queue of rating updates on a Redis
+// stream with a consumer group. Entries stay pending until acked, entries of a
+// consumer that died are claimed by the others. Replays are harmless, the
+// Postgres writes only apply newer versions.
+type UpdateQueue struct {
+	client *redis.Client
+}
+
+func NewUpdateQueue(client *redis.Client) *UpdateQueue {
+	return &UpdateQueue{client: client}
+}
+
+// Push - Append updates, one round trip for the whole slice
+func (q *UpdateQueue) Push(ctx context.Context, updates ...models.RatingUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	pipe := q.client.Pipeline()
+	for _, u := range updates {
+		payload, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: UpdateStreamKey, Values: []interface{}{updateField, payload}})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// EnsureGroup - Create the consumer group (and stream) unless it exists. A new
+// group starts at the beginning so updates queued before it are not skipped.
+func (q *UpdateQueue) EnsureGroup(ctx context.Context) error {
+	err := q.client.XGroupCreateMkStream(ctx, UpdateStreamKey, updateGroup, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// Read - Up to count new entries for consumer, waits at most block
+func (q *UpdateQueue) Read(ctx context.Context, consumer string, count int, block time.Duration) ([]QueuedUpdate, error) {
+	streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    updateGroup,
+		Consumer: consumer,
+		Streams:  []string{UpdateStreamKey, ">"},
+		Count:    int64(count),
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []QueuedUpdate
+	for _, s := range streams {
+		entries = append(entries, decodeUpdates(s.Messages)...)
+	}
+	return entries, nil
+}
+
+// Claim - Take over up to count entries pending for longer than minIdle, left
+// behind by a crashed consumer or a failed write
+func (q *UpdateQueue) Claim(ctx context.Context, consumer string, minIdle time.Duration, count int) ([]QueuedUpdate, error) {
+	msgs, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   UpdateStreamKey,
+		Group:    updateGroup,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    "0",
+		Count:    int64(count),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeUpdates(msgs), nil
+}
+
+// Ack - Mark entries as persisted and drop them from the stream
+func (q *UpdateQueue) Ack(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	pipe := q.client.Pipeline()
+	pipe.XAck(ctx, UpdateStreamKey, updateGroup, ids...)
+	pipe.XDel(ctx, UpdateStreamKey, ids...)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// decodeUpdates - Undecodable entries keep a zero update and are acked as-is
+func decodeUpdates(msgs []redis.XMessage) []QueuedUpdate {
+	entries := make([]QueuedUpdate, 0, len(msgs))
+	for _, m := range msgs {
+		entry := QueuedUpdate{ID: m.ID}
+		if payload, ok := m.Values[updateField].(string); ok {
+			json.Unmarshal([]byte(payload), &entry.Update)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+// Ranks computed by Postgres window functions, the read path while Redis is
+// down. Every query ranks the whole board, fine for a fallback but not for
+// the hot path.
+
+type rankedRow struct {
+	ID         int64  `db:"id"`
+	Username   string `db:"username"`
+	Rating     int    `db:"rating"`
+	Decayed    bool   `db:"decayed"`
+	Region     string `db:"region"`
+	Rank       int64  `db:"rank"`
+	RegionRank int64  `db:"region_rank"`
+}
+
+func (row rankedRow) user() models.RankedUser {
+	return models.RankedUser{
+		Rank:       row.Rank,
+		ID:         row.ID,
+		Username:   row.Username,
+		Rating:     row.Rating,
+		Decayed:    row.Decayed,
+		Region:     row.Region,
+		RegionRank: row.RegionRank,
+	}
+}
+
+// rankedColumns - What the queries select from "ranked", as in rankedRow
+const rankedColumns = "id, username, rating, decayed, region, rank, region_rank"
+
+// rankedQuery - CTE "ranked" with rank and region_rank of every player on a
+// board, plus the ORDER BY for its rows. Mirrors the sorted sets: equal
+// ratings share a competition or dense rank (Redis counts integer ratings),
+// the row order and ordinal ranks follow the set order, by achievement time
+// on tie-break boards, then by member. Non-global boards take the board as $1.
+func rankedQuery(board string, mode models.RankMode, tieBreak bool) (string, string) {
+	order := "rating DESC"
+	if tieBreak {
+		order += ", achieved_at"
+	}
+	order += ", id DESC"
+	rank := "RANK() OVER (%s ORDER BY rating DESC)"
+	switch mode {
+	case models.RankDense:
+		rank = "DENSE_RANK() OVER (%s ORDER BY rating DESC)"
+	case models.RankOrdinal:
+		rank = "ROW_NUMBER() OVER (%s ORDER BY " + order + ")"
+	}
+	if board == "" || board == models.DefaultBoard {
+		return `WITH players AS (
+			SELECT id, username, rating, rating_achieved_at AS achieved_at, rating_decayed AS decayed, region FROM users
+		), ranked AS (
+			SELECT id, username, rating, achieved_at, decayed, region,
+			` + fmt.Sprintf(rank, "") + ` AS rank,
+			` + fmt.Sprintf(rank, "PARTITION BY region") + ` AS region_rank
+			FROM players
+		)`, order
+	}
+	return `WITH players AS (
+			SELECT u.id, u.username, b.rating, b.achieved_at, b.decayed FROM board_ratings b
+			JOIN users u ON u.id = b.user_id WHERE b.board_id = $1
+		), ranked AS (
+			SELECT id, username, rating, achieved_at, decayed, '' AS region,
+			` + fmt.Sprintf(rank, "") + ` AS rank, 0::BIGINT AS region_rank
+			FROM players
+		)`, order
+}
+
+// GetRankedPage - Like CacheRepository.GetLeaderboard for the all-time board,
+// plus the number of players on it. With a region (global board only) the
+// page holds that region's players with region ranks.
+func (r *UserRepository) GetRankedPage(ctx context.Context, board string, mode models.RankMode, tieBreak bool, region string, limit, offset int64) ([]models.RankedUser, int64, error) {
+	global := board == "" || board == models.DefaultBoard
+	query, order := rankedQuery(board, mode, tieBreak)
+	query += " SELECT " + rankedColumns + " FROM ranked"
+	var rows []rankedRow
+	var total int64
+	var err error
+	switch {
+	case !global:
+		err = r.db.SelectContext(ctx, &rows, query+" ORDER BY "+order+" LIMIT $2 OFFSET $3", board, limit, offset)
+		if err == nil {
+			err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM board_ratings WHERE board_id = $1", board)
+		}
+	case region != "":
+		err = r.db.SelectContext(ctx, &rows, query+" WHERE region = $1 ORDER BY "+order+" LIMIT $2 OFFSET $3", region, limit, offset)
+		if err == nil {
+			err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM users WHERE region = $1", region)
+		}
+	default:
+		err = r.db.SelectContext(ctx, &rows, query+" ORDER BY "+order+" LIMIT $1 OFFSET $2", limit, offset)
+		if err == nil {
+			err = r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM users")
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	users := make([]models.RankedUser, len(rows))
+	for i, row := range rows {
+		users[i] = row.user()
+		// Regions only show on regional pages, as in Redis
+		if region == "" {
+			users[i].Region = ""
+			users[i].RegionRank = 0
+		}
+	}
+	return users, total, nil
+}
+
+// GetRankedUser - Like CacheRepository.GetRank, sql.ErrNoRows if the user is
+// not on the board
+func (r *UserRepository) GetRankedUser(ctx context.Context, board string, mode models.RankMode, tieBreak bool, userID int64) (*models.RankedUser, error) {
+	var row rankedRow
+	var err error
+	query, _ := rankedQuery(board, mode, tieBreak)
+	query += " SELECT " + rankedColumns + " FROM ranked"
+	if board == "" || board == models.DefaultBoard {
+		err = r.db.GetContext(ctx, &row, query+" WHERE id = $1", userID)
+	} else {
+		err = r.db.GetContext(ctx, &row, query+" WHERE id = $2", board, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	user := row.user()
+	if user.Region == "" {
+		user.RegionRank = 0
+	}
+	return &user, nil
+}
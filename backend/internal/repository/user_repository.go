@@ -2,8 +2,10 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/stilln0thing/matiks_leaderboard/internal/models"
 )
 
@@ -19,15 +21,41 @@ func NewUserRepository(db *sqlx.DB) *UserRepository {
 func (r *UserRepository) GetAllUsers(ctx context.Context) ([]models.User, error) {
 	var users []models.User
 	err := r.db.SelectContext(ctx, &users,
-		"SELECT id, username, rating, version FROM users ORDER BY id")
+		"SELECT id, username, rating, version, rating_achieved_at, rating_deviation, volatility, rating_decayed, region FROM users ORDER BY id")
 	return users, err
 }
 
+// GetUsersAfter - Like GetAllUsers, one keyset page of limit users after afterID
+func (r *UserRepository) GetUsersAfter(ctx context.Context, afterID int64, limit int) ([]models.User, error) {
+	var users []models.User
+	err := r.db.SelectContext(ctx, &users,
+		`SELECT id, username, rating, version, rating_achieved_at, rating_deviation, volatility, rating_decayed, region
+		FROM users WHERE id > $1 ORDER BY id LIMIT $2`, afterID, limit)
+	return users, err
+}
+
+// GetVersions - Current version of each existing user
+func (r *UserRepository) GetVersions(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	var rows []struct {
+		ID      int64 `db:"id"`
+		Version int64 `db:"version"`
+	}
+	err := r.db.SelectContext(ctx, &rows, "SELECT id, version FROM users WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		versions[row.ID] = row.Version
+	}
+	return versions, nil
+}
+
 // GetUserByID - Get single user
 func (r *UserRepository) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
 	var user models.User
 	err := r.db.GetContext(ctx, &user,
-		"SELECT id, username, rating, version FROM users WHERE id = $1", id)
+		"SELECT id, username, rating, version, region FROM users WHERE id = $1", id)
 	if err != nil {
 		return nil, err
 	}
@@ -39,12 +67,13 @@ func (r *UserRepository) SearchUsers(ctx context.Context, query string) ([]model
 	var users []models.User
 	searchQuery := "%" + query + "%"
 	err := r.db.SelectContext(ctx, &users,
-		"SELECT id, username, rating, version FROM users WHERE LOWER(username) LIKE LOWER($1) ORDER BY rating DESC LIMIT 100",
+		"SELECT id, username, rating, version, region FROM users WHERE LOWER(username) LIKE LOWER($1) ORDER BY rating DESC LIMIT 100",
 		searchQuery)
 	return users, err
 }
 
 // BatchUpdateRatings - Efficient batch update with version check
+// Every applied update also appends its old and new rating to rating_history
 func (r *UserRepository) BatchUpdateRatings(ctx context.Context, updates []models.RatingUpdate) error {
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
@@ -52,13 +81,53 @@ func (r *UserRepository) BatchUpdateRatings(ctx context.Context, updates []model
 	}
 	defer tx.Rollback()
 	stmt, err := tx.PrepareContext(ctx,
-		"UPDATE users SET rating = $1, version = $2, updated_at = NOW() WHERE id = $3 AND version < $2")
+		`WITH old AS (
+			SELECT rating FROM users WHERE id = $3 AND version < $2 FOR UPDATE
+		), upd AS (
+			UPDATE users SET rating = $1, version = $2, updated_at = NOW(),
+			rating_achieved_at = CASE WHEN rating = $1 THEN rating_achieved_at ELSE $4 END,
+			rating_deviation = COALESCE(NULLIF($5::DOUBLE PRECISION, 0), rating_deviation),
+			volatility = COALESCE(NULLIF($6::DOUBLE PRECISION, 0), volatility),
+			rating_decayed = $7
+			WHERE id = $3 AND version < $2
+			RETURNING id
+		)
+		INSERT INTO rating_history (board_id, user_id, old_rating, new_rating, version, source, recorded_at)
+		SELECT $8, upd.id, old.rating, $1, $2, $9, $4 FROM upd, old`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
+	// Non-global boards live in board_ratings, same version guard
+	boardStmt, err := tx.PrepareContext(ctx,
+		`WITH old AS (
+			SELECT rating FROM board_ratings WHERE board_id = $1 AND user_id = $2 FOR UPDATE
+		), upd AS (
+			INSERT INTO board_ratings (board_id, user_id, rating, version, achieved_at, rating_deviation, volatility, decayed, updated_at)
+			VALUES ($1, $2, $3, $4, $5, COALESCE(NULLIF($6::DOUBLE PRECISION, 0), 350), COALESCE(NULLIF($7::DOUBLE PRECISION, 0), 0.06), $8, NOW())
+			ON CONFLICT (board_id, user_id) DO UPDATE SET rating = EXCLUDED.rating, version = EXCLUDED.version, updated_at = NOW(),
+			decayed = EXCLUDED.decayed,
+			achieved_at = CASE WHEN board_ratings.rating = EXCLUDED.rating THEN board_ratings.achieved_at ELSE EXCLUDED.achieved_at END,
+			rating_deviation = CASE WHEN $6::DOUBLE PRECISION = 0 THEN board_ratings.rating_deviation ELSE EXCLUDED.rating_deviation END,
+			volatility = CASE WHEN $7::DOUBLE PRECISION = 0 THEN board_ratings.volatility ELSE EXCLUDED.volatility END
+			WHERE board_ratings.version < EXCLUDED.version
+			RETURNING user_id
+		)
+		INSERT INTO rating_history (board_id, user_id, old_rating, new_rating, version, source, recorded_at)
+		SELECT $1, upd.user_id, (SELECT rating FROM old), $3, $4, $9, $5 FROM upd`)
+	if err != nil {
+		return err
+	}
+	defer boardStmt.Close()
 	for _, u := range updates {
-		_, err = stmt.ExecContext(ctx, u.Rating, u.Version, u.UserID)
+		// AchievedAt is the time the update was made, used as the history timestamp
+		if u.BoardID == "" || u.BoardID == models.DefaultBoard {
+			_, err = stmt.ExecContext(ctx, u.Rating, u.Version, u.UserID, u.AchievedAt, u.Deviation, u.Volatility, u.Decayed,
+				models.DefaultBoard, u.Source)
+		} else {
+			_, err = boardStmt.ExecContext(ctx, u.BoardID, u.UserID, u.Rating, u.Version, u.AchievedAt, u.Deviation, u.Volatility, u.Decayed,
+				u.Source)
+		}
 		if err != nil {
 			return err
 		}
@@ -66,6 +135,33 @@ func (r *UserRepository) BatchUpdateRatings(ctx context.Context, updates []model
 	return tx.Commit()
 }
 
+// SetRegion - Change a user's region, false if the user does not exist
+func (r *UserRepository) SetRegion(ctx context.Context, id int64, region string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, "UPDATE users SET region = $2 WHERE id = $1", id, region)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// GetInactiveUserIDs - Users of a board without a rating write since before
+// Keyset paged by id so a run makes progress while its own writes are queued
+func (r *UserRepository) GetInactiveUserIDs(ctx context.Context, board string, before time.Time, afterID int64, limit int) ([]int64, error) {
+	var ids []int64
+	var err error
+	if board == "" || board == models.DefaultBoard {
+		err = r.db.SelectContext(ctx, &ids,
+			"SELECT id FROM users WHERE updated_at < $1 AND id > $2 ORDER BY id LIMIT $3",
+			before, afterID, limit)
+	} else {
+		err = r.db.SelectContext(ctx, &ids,
+			"SELECT user_id FROM board_ratings WHERE board_id = $1 AND updated_at < $2 AND user_id > $3 ORDER BY user_id LIMIT $4",
+			board, before, afterID, limit)
+	}
+	return ids, err
+}
+
 // CreateUser - Create new user
 func (r *UserRepository) CreateUser(ctx context.Context, username string, rating int) (*models.User, error) {
 	var user models.User
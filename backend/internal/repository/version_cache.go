@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+)
+
+// VersionClockKey - Last version handed out by NextVersion
+const VersionClockKey = "leaderboard:version"
+
+// versionLua - Versions are int64 decimal strings, beyond the 2^53 Lua's
+// doubles hold exactly, so they are only ever compared as strings
+const versionLua = `
+local function newerVersion(a, b)
+    if #a ~= #b then
+        return #a > #b
+    end
+    return a > b
+end
+`
+
+// Lua script for a hybrid logical clock on the Redis server: its time in
+// nanoseconds, or one past the last version if that is ahead. One clock for
+// every instance, so app server skew does not matter. KEYS: clock key
+const nextVersionScript = versionLua + `
+local t = redis.call('TIME')
+local now = t[1] .. string.format('%06d', tonumber(t[2])) .. '000'
+redis.call('INCR', KEYS[1])
+local v = redis.call('GET', KEYS[1])
+if newerVersion(now, v) then
+    redis.call('SET', KEYS[1], now)
+    return now
+end
+return v
+`
+
+// Lua script moving the clock forward to at least ARGV[1]. KEYS: clock key
+const seedVersionScript = versionLua + `
+local v = redis.call('GET', KEYS[1]) or '0'
+if newerVersion(ARGV[1], v) then
+    redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`
+
+// NextVersion - A version larger than any handed out before, on any instance
+func (r *CacheRepository) NextVersion(ctx context.Context) (int64, error) {
+	v, err := r.nextVersionScript.Run(ctx, r.client, []string{VersionClockKey}).Text()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// SeedVersion - Make sure NextVersion stays above version, e.g. versions that
+// were assigned by app server clocks before the shared clock existed
+func (r *CacheRepository) SeedVersion(ctx context.Context, version int64) error {
+	return r.seedVersionScript.Run(ctx, r.client, []string{VersionClockKey}, version).Err()
+}
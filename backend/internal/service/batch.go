@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+// MaxBatchSize - Upper bound for one batch, keeps the Lua script short
+const MaxBatchSize = 1000
+
+// UpdateRatings - Validate the whole batch, apply it to Redis in one round
+// trip, then queue every applied entry for the async DB write. Stale checks
+// need Redis, ErrDegraded while it is down.
+func (s *LeaderboardService) UpdateRatings(ctx context.Context, boardID string, entries []models.RatingUpdate) ([]models.BatchItemResult, error) {
+	board, err := s.board(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]models.BatchItemResult, len(entries))
+	valid := make([]models.RatingUpdate, 0, len(entries))
+	validIdx := make([]int, 0, len(entries))
+	seen := make(map[int64]bool, len(entries))
+	for i, e := range entries {
+		results[i] = models.BatchItemResult{UserID: e.UserID, Rating: e.Rating, Status: models.BatchRejected}
+		switch {
+		case e.UserID <= 0:
+			results[i].Error = "invalid user ID"
+		case e.Rating < models.MinRating || e.Rating > models.MaxRating:
+			results[i].Error = fmt.Sprintf("rating must be between %d and %d", models.MinRating, models.MaxRating)
+		case seen[e.UserID]:
+			results[i].Error = "duplicate user in batch"
+		default:
+			seen[e.UserID] = true
+			valid = append(valid, e)
+			validIdx = append(validIdx, i)
+		}
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+	var version int64
+	var applied []int64
+	now := time.Now()
+	ok, err := s.withRedis(func() error {
+		version, err = s.versions.Next(ctx)
+		if err != nil {
+			return err
+		}
+		applied, err = s.cacheRepo.UpdateRatings(ctx, boardID, board.TieBreak, true, version, now, valid)
+		return err
+	})
+	if !ok {
+		return nil, ErrDegraded
+	}
+	if err != nil {
+		return nil, err
+	}
+	queued := make([]models.RatingUpdate, 0, len(applied))
+	for j, status := range applied {
+		i := validIdx[j]
+		switch status {
+		case 1:
+			results[i].Status = models.BatchApplied
+			results[i].Version = version
+			queued = append(queued, models.RatingUpdate{
+				BoardID:    boardID,
+				UserID:     valid[j].UserID,
+				Rating:     valid[j].Rating,
+				Version:    version,
+				AchievedAt: now,
+				Source:     models.SourceBatch,
+			})
+		case 0:
+			results[i].Status = models.BatchStale
+		default:
+			results[i].Status = models.BatchUnknownUser
+		}
+	}
+	if err := s.enqueue(ctx, queued...); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ResetRatings - Overwrite ratings as a bookkeeping step (e.g. season reset)
+// Skips the time-windowed boards. version must be taken before the ratings
+// the entries were computed from were read, so later updates win over them
+func (s *LeaderboardService) ResetRatings(ctx context.Context, boardID string, version int64, entries []models.RatingUpdate) error {
+	board, err := s.board(ctx, boardID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	applied, err := s.cacheRepo.UpdateRatings(ctx, boardID, board.TieBreak, false, version, now, entries)
+	if err != nil {
+		return err
+	}
+	queued := make([]models.RatingUpdate, 0, len(applied))
+	for i, status := range applied {
+		// Stale means a real update landed after the snapshot, keep it
+		if status != 1 {
+			continue
+		}
+		update := entries[i]
+		update.BoardID = boardID
+		update.Version = version
+		update.AchievedAt = now
+		queued = append(queued, update)
+	}
+	return s.enqueue(ctx, queued...)
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
+)
+
+const (
+	// Consecutive connection failures before Redis counts as down
+	breakerThreshold = 3
+	// How long to stay on Postgres before probing Redis again
+	breakerCooldown = 5 * time.Second
+)
+
+// redisBreaker - Circuit breaker in front of Redis. Opens after
+// breakerThreshold calls in a row could not reach Redis, or right away once a
+// write went only to Postgres. While open no call is attempted; a background
+// probe closes it again (see recoverRedis).
+type redisBreaker struct {
+	mu       sync.Mutex
+	failures int
+	isOpen   bool
+}
+
+// done - Record the outcome of a call, true if it opened the breaker
+func (b *redisBreaker) done(err error) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !repository.IsUnavailable(err) {
+		b.failures = 0
+		return false
+	}
+	b.failures++
+	if b.isOpen || b.failures < breakerThreshold {
+		return false
+	}
+	b.isOpen = true
+	log.Printf("[Service] Redis unavailable (%v), serving from Postgres", err)
+	return true
+}
+
+// trip - Open the breaker, true if it was closed
+func (b *redisBreaker) trip() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.isOpen {
+		return false
+	}
+	b.isOpen = true
+	log.Println("[Service] Write went only to Postgres, Redis needs a resync")
+	return true
+}
+
+// closeIf - Close the breaker if ready still holds, checked under the lock
+func (b *redisBreaker) closeIf(ready func() bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !ready() {
+		return false
+	}
+	b.isOpen = false
+	b.failures = 0
+	return true
+}
+
+func (b *redisBreaker) open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.isOpen
+}
+
+// withRedis - Run fn against Redis unless the breaker is open. false means
+// fn did not run or could not reach Redis and the caller should fall back to
+// Postgres, otherwise fn's error is returned.
+func (s *LeaderboardService) withRedis(fn func() error) (bool, error) {
+	if s.breaker.open() {
+		return false, nil
+	}
+	err := fn()
+	if s.breaker.done(err) {
+		s.startRecovery()
+	}
+	if repository.IsUnavailable(err) {
+		return false, nil
+	}
+	return true, err
+}
+
+// tripBreaker - A write reached Postgres but not Redis. Until the recovery
+// probe has seeded the shared clock past its version Redis must not take
+// writes, until the resync has run it must not compute any.
+func (s *LeaderboardService) tripBreaker() {
+	if s.breaker.trip() {
+		s.startRecovery()
+	}
+}
+
+// startRecovery - Count a new outage and start recovering from it
+func (s *LeaderboardService) startRecovery() {
+	go s.recoverRedis(s.outages.Add(1))
+}
+
+// recoverRedis - Probe Redis every breakerCooldown while the breaker is open.
+// The probe seeds the shared version clock with the highest version handed
+// out for degraded writes, so Redis versions after recovery are newer than
+// every one of them. A degraded write that took a version after the probe
+// read it needs another round, so closing checks nothing was handed out since.
+// Absolute writes go to Redis again from then on, writes computed from Redis
+// ratings wait for the resync (see resyncPending).
+func (s *LeaderboardService) recoverRedis(outage int64) {
+	for {
+		time.Sleep(breakerCooldown)
+		seeded := s.fallbackVersions.current()
+		ctx, cancel := context.WithTimeout(context.Background(), breakerCooldown)
+		err := s.cacheRepo.SeedVersion(ctx, seeded)
+		cancel()
+		if err != nil {
+			continue
+		}
+		if s.breaker.closeIf(func() bool { return s.fallbackVersions.current() == seeded }) {
+			break
+		}
+	}
+	log.Println("[Service] Redis is back, resyncing")
+	for {
+		err := s.resync()
+		if err == nil {
+			break
+		}
+		log.Printf("[Service] Error resyncing Redis: %v", err)
+		if s.breaker.open() {
+			return // Down again, that recovery resyncs
+		}
+		time.Sleep(breakerCooldown)
+	}
+	// A later outage still needs its own resync
+	if s.outages.Load() == outage {
+		s.resynced.Store(outage)
+	}
+	log.Println("[Service] Redis resynced")
+}
+
+// resync - Run the recovery callbacks in order, stop at the first error
+func (s *LeaderboardService) resync() error {
+	s.mu.RLock()
+	listeners := s.recoverListeners
+	s.mu.RUnlock()
+	for _, fn := range listeners {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resyncPending - Whether Redis may still miss writes that went only to
+// Postgres. Writes computed from Redis ratings (deltas, matches, decay) would
+// overwrite those with a newer version and are refused until then.
+func (s *LeaderboardService) resyncPending() bool {
+	return s.breaker.open() || s.outages.Load() != s.resynced.Load()
+}
+
+// Degraded - Whether Redis is considered down and Postgres serves requests
+func (s *LeaderboardService) Degraded() bool {
+	return s.breaker.open()
+}
+
+// OnRedisRecover - Register a callback that repairs Redis after an outage,
+// e.g. from writes that went only to Postgres meanwhile. Callbacks run in
+// order once Redis is reachable again and are retried until all succeed.
+func (s *LeaderboardService) OnRedisRecover(fn func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recoverListeners = append(s.recoverListeners, fn)
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
+)
+
+// replayChunkSize - Dead letters requeued per round trip
+const replayChunkSize = 500
+
+// DeadLetterService - Inspect and replay updates the DB writer gave up on
+type DeadLetterService struct {
+	repo  *repository.DeadLetterRepository
+	queue *repository.UpdateQueue
+}
+
+func NewDeadLetterService(repo *repository.DeadLetterRepository, queue *repository.UpdateQueue) *DeadLetterService {
+	return &DeadLetterService{repo: repo, queue: queue}
+}
+
+// List - A page of dead letters plus how many there are in total
+func (s *DeadLetterService) List(ctx context.Context, afterID int64, limit int) ([]models.DeadLetter, int64, error) {
+	letters, err := s.repo.List(ctx, afterID, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.repo.Count(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return letters, total, nil
+}
+
+// Replay - Put a dead letter back on the update queue with its original
+// version, so it still loses to anything newer. Fails again into a new dead
+// letter if the cause is not fixed.
+func (s *DeadLetterService) Replay(ctx context.Context, id int64) error {
+	letter, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.queue.Push(ctx, letter.Update); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// ReplayAll - Replay every dead letter, returns how many were requeued
+func (s *DeadLetterService) ReplayAll(ctx context.Context) (int, error) {
+	var lastID int64
+	replayed := 0
+	for {
+		letters, err := s.repo.List(ctx, lastID, replayChunkSize)
+		if err != nil {
+			return replayed, err
+		}
+		if len(letters) == 0 {
+			break
+		}
+		updates := make([]models.RatingUpdate, len(letters))
+		ids := make([]int64, len(letters))
+		for i, l := range letters {
+			updates[i] = l.Update
+			ids[i] = l.ID
+		}
+		// Requeue first, a crash in between replays twice rather than never
+		if err := s.queue.Push(ctx, updates...); err != nil {
+			return replayed, err
+		}
+		if err := s.repo.DeleteMany(ctx, ids); err != nil {
+			return replayed, err
+		}
+		replayed += len(letters)
+		lastID = ids[len(ids)-1]
+	}
+	log.Printf("[DeadLetter] Replayed %d updates", replayed)
+	return replayed, nil
+}
+
+// Discard - Drop a dead letter without applying it
+func (s *DeadLetterService) Discard(ctx context.Context, id int64) error {
+	return s.repo.Delete(ctx, id)
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+// decayChunkSize - Users per DB page and Lua call
+const decayChunkSize = 500
+
+// DecayInactive - Lower the rating of every player on the board without a
+// rating update for inactiveFor by points, never below floor. The decay is a
+// versioned write, so a real update that lands first always wins. The DB write
+// bumps updated_at, a player keeps decaying once per inactiveFor.
+// Returns the number of decayed players. Decays the rating in Redis,
+// ErrDegraded while that may miss writes.
+func (s *LeaderboardService) DecayInactive(ctx context.Context, boardID string, inactiveFor time.Duration, points, floor int) (int, error) {
+	board, err := s.board(ctx, boardID)
+	if err != nil {
+		return 0, err
+	}
+	if s.resyncPending() {
+		return 0, ErrDegraded
+	}
+	now := time.Now()
+	cutoff := now.Add(-inactiveFor)
+	var lastID int64
+	decayed := 0
+	for {
+		ids, err := s.userRepo.GetInactiveUserIDs(ctx, boardID, cutoff, lastID, decayChunkSize)
+		if err != nil {
+			return decayed, err
+		}
+		if len(ids) == 0 {
+			return decayed, nil
+		}
+		lastID = ids[len(ids)-1]
+		version, err := s.versions.Next(ctx)
+		if err != nil {
+			return decayed, err
+		}
+		ratings, err := s.cacheRepo.DecayRatings(ctx, boardID, board.TieBreak, version, now, cutoff, points, floor, ids)
+		if err != nil {
+			return decayed, err
+		}
+		queued := make([]models.RatingUpdate, 0, len(ratings))
+		for i, rating := range ratings {
+			if rating == 0 {
+				continue
+			}
+			queued = append(queued, models.RatingUpdate{
+				BoardID:    boardID,
+				UserID:     ids[i],
+				Rating:     int(rating),
+				Version:    version,
+				AchievedAt: now,
+				Decayed:    true,
+				Source:     models.SourceDecay,
+			})
+		}
+		// A lost write would leave updated_at behind and decay again
+		if err := s.enqueue(ctx, queued...); err != nil {
+			return decayed, err
+		}
+		decayed += len(queued)
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
+)
+
+var (
+	ErrInvalidRange = errors.New("'from' must be before 'to'")
+	ErrFutureTime   = errors.New("'at' must not be in the future")
+	ErrNoSnapshot   = errors.New("'at' is before the oldest snapshot of the board")
+)
+
+// Range used when the caller leaves out from
+const defaultHistoryRange = 30 * 24 * time.Hour
+
+type HistoryService struct {
+	historyRepo  *repository.HistoryRepository
+	snapshotRepo *repository.SnapshotRepository
+	cacheRepo    *repository.CacheRepository
+	leaderboard  *LeaderboardService
+}
+
+func NewHistoryService(
+	historyRepo *repository.HistoryRepository,
+	snapshotRepo *repository.SnapshotRepository,
+	cacheRepo *repository.CacheRepository,
+	leaderboard *LeaderboardService,
+) *HistoryService {
+	return &HistoryService{
+		historyRepo:  historyRepo,
+		snapshotRepo: snapshotRepo,
+		cacheRepo:    cacheRepo,
+		leaderboard:  leaderboard,
+	}
+}
+
+// GetHistory - Rating series of a user plus all-time peaks
+// Zero from/to default to the last 30 days
+func (s *HistoryService) GetHistory(ctx context.Context, boardID string, userID int64, from, to time.Time) (*models.RatingHistory, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultHistoryRange)
+	}
+	if !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+	// Also checks board and user exist
+	current, err := s.leaderboard.GetUserRank(ctx, boardID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	changes, err := s.historyRepo.GetHistory(ctx, boardID, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	peakRating, err := s.historyRepo.GetPeakRating(ctx, boardID, userID)
+	if err != nil {
+		return nil, err
+	}
+	peakRank, err := s.cacheRepo.GetPeakRank(ctx, boardID, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Ratings from before the history existed only show up in the cache
+	if current.Rating > peakRating {
+		peakRating = current.Rating
+	}
+	if peakRank == 0 {
+		peakRank = current.Rank
+	}
+	return &models.RatingHistory{
+		UserID:     userID,
+		BoardID:    boardID,
+		From:       from,
+		To:         to,
+		Changes:    changes,
+		PeakRating: peakRating,
+		PeakRank:   peakRank,
+	}, nil
+}
+
+// GetLeaderboardAt - Offset page of a board as it was at a past time
+// Rebuilt from the newest snapshot before at plus the rating history since
+func (s *HistoryService) GetLeaderboardAt(ctx context.Context, boardID string, at time.Time, limit, offset int64) ([]models.RankedUser, int64, error) {
+	board, err := s.leaderboard.GetBoard(ctx, boardID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if at.After(time.Now()) {
+		return nil, 0, ErrFutureTime
+	}
+	snapshot, err := s.snapshot(ctx, boardID, at)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.snapshotRepo.GetLeaderboardAt(ctx, boardID, snapshot, at, board.RankMode, limit, offset)
+}
+
+// GetUserRankAt - Rank and rating of a user at a past time
+func (s *HistoryService) GetUserRankAt(ctx context.Context, boardID string, userID int64, at time.Time) (*models.RankedUser, error) {
+	board, err := s.leaderboard.GetBoard(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	if at.After(time.Now()) {
+		return nil, ErrFutureTime
+	}
+	snapshot, err := s.snapshot(ctx, boardID, at)
+	if err != nil {
+		return nil, err
+	}
+	return s.snapshotRepo.GetRankAt(ctx, boardID, snapshot, at, board.RankMode, userID)
+}
+
+// snapshot - Newest snapshot to rebuild the board at at from, ErrNoSnapshot
+// before the first one or past the retention
+func (s *HistoryService) snapshot(ctx context.Context, boardID string, at time.Time) (*models.Snapshot, error) {
+	snapshot, err := s.snapshotRepo.LatestSnapshot(ctx, boardID, at)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		return nil, ErrNoSnapshot
+	}
+	return snapshot, nil
+}
+
+// TakeSnapshot - Snapshot a board unless its newest snapshot is younger than every
+// Returns nil when nothing was due
+func (s *HistoryService) TakeSnapshot(ctx context.Context, boardID string, every time.Duration) (*models.Snapshot, error) {
+	now := time.Now()
+	latest, err := s.snapshotRepo.LatestSnapshot(ctx, boardID, now)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && now.Sub(latest.TakenAt) < every {
+		return nil, nil
+	}
+	return s.snapshotRepo.CreateSnapshot(ctx, boardID)
+}
+
+// PruneSnapshots - Drop snapshots older than retention
+// Times before the oldest snapshot are then answered with ErrNoSnapshot
+func (s *HistoryService) PruneSnapshots(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.snapshotRepo.DeleteSnapshotsBefore(ctx, time.Now().Add(-retention))
+}
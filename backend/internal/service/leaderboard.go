@@ -2,46 +2,283 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"log"
+	"regexp"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+	"github.com/stilln0thing/matiks_leaderboard/internal/rating"
 	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
 )
 
+var (
+	ErrBoardNotFound     = errors.New("leaderboard not found")
+	ErrBoardExists       = errors.New("leaderboard already exists")
+	ErrInvalidBoard      = errors.New("invalid leaderboard id")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrInvalidRegion     = errors.New("region must be a two letter country code")
+	ErrRegionUnsupported = errors.New("regions are only available on the all-time global board")
+	ErrDegraded          = errors.New("not available while Redis is down")
+)
+
+// Board IDs and regions end up in Redis keys, keep them simple
+var (
+	boardIDPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+	regionPattern  = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
 type LeaderboardService struct {
-	userRepo    *repository.UserRepository
-	cacheRepo   *repository.CacheRepository
-	updateQueue chan<- models.RatingUpdate // Write-only channel
+	userRepo     *repository.UserRepository
+	boardRepo    *repository.BoardRepository
+	cacheRepo    *repository.CacheRepository
+	ratingSystem rating.System           // Used for match results
+	updateQueue  *repository.UpdateQueue // Durable queue drained by the DB writer
+	versions     VersionSource
+	breaker      redisBreaker
+	// Versions of writes that go straight to Postgres while Redis is down
+	fallbackVersions clockVersions
+
+	mu               sync.RWMutex
+	boards           map[string]models.Leaderboard
+	listeners        []func(models.RatingEvent)
+	recoverListeners []func() error
+	// Redis outages so far and the last one resynced, see resyncPending
+	outages  atomic.Int64
+	resynced atomic.Int64
 }
 
 func NewLeaderboardService(
 	userRepo *repository.UserRepository,
+	boardRepo *repository.BoardRepository,
 	cacheRepo *repository.CacheRepository,
-	updateQueue chan<- models.RatingUpdate,
+	ratingSystem rating.System,
+	updateQueue *repository.UpdateQueue,
+	versions VersionSource,
 ) *LeaderboardService {
 	return &LeaderboardService{
-		userRepo:    userRepo,
-		cacheRepo:   cacheRepo,
-		updateQueue: updateQueue,
+		userRepo:     userRepo,
+		boardRepo:    boardRepo,
+		cacheRepo:    cacheRepo,
+		ratingSystem: ratingSystem,
+		updateQueue:  updateQueue,
+		versions:     versions,
+		boards: map[string]models.Leaderboard{
+			models.DefaultBoard: {ID: models.DefaultBoard, Name: "Global", RankMode: models.RankCompetition},
+		},
+	}
+}
+
+// GetBoards - All boards, read from Postgres so boards created by other
+// instances are included. Refreshes the cached definitions.
+func (s *LeaderboardService) GetBoards(ctx context.Context) ([]models.Leaderboard, error) {
+	boards, err := s.boardRepo.GetBoards(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	for _, b := range boards {
+		s.boards[b.ID] = b
+	}
+	s.mu.Unlock()
+	return boards, nil
+}
+
+// CreateBoard - Register a new board (empty until ratings arrive)
+// tieBreak is fixed at creation since it changes how scores are stored
+func (s *LeaderboardService) CreateBoard(ctx context.Context, id, name string, mode models.RankMode, tieBreak bool) (*models.Leaderboard, error) {
+	if !boardIDPattern.MatchString(id) {
+		return nil, ErrInvalidBoard
+	}
+	if _, err := s.board(ctx, id); err == nil {
+		return nil, ErrBoardExists
+	}
+	board, err := s.boardRepo.CreateBoard(ctx, id, name, mode, tieBreak)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.boards[board.ID] = *board
+	s.mu.Unlock()
+	s.publishBoard(ctx, board.ID)
+	return board, nil
+}
+
+// UpdateBoard - Rename a board or switch its rank mode
+// Ranks are computed on read, so a new mode applies immediately
+func (s *LeaderboardService) UpdateBoard(ctx context.Context, id, name string, mode models.RankMode) (*models.Leaderboard, error) {
+	if _, err := s.board(ctx, id); err != nil {
+		return nil, err
+	}
+	board, err := s.boardRepo.UpdateBoard(ctx, id, name, mode)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.boards[board.ID] = *board
+	s.mu.Unlock()
+	s.publishBoard(ctx, board.ID)
+	return board, nil
+}
+
+// SetGlobalTieBreak - Opt the global board, created without tie-breaking,
+// in or out of earliest-achiever ordering. Must run before WarmCache, which
+// rebuilds the stored scores; the time-windowed sets follow as players write.
+func (s *LeaderboardService) SetGlobalTieBreak(ctx context.Context, tieBreak bool) error {
+	changed, err := s.boardRepo.SetTieBreak(ctx, models.DefaultBoard, tieBreak)
+	if err != nil || !changed {
+		return err
+	}
+	log.Printf("[Service] Tie-break on the global board set to %v", tieBreak)
+	s.forgetBoard(models.DefaultBoard)
+	s.publishBoard(ctx, models.DefaultBoard)
+	return nil
+}
+
+// publishBoard - Tell the other instances to drop their cached definition.
+// Best effort, the board row is already committed
+func (s *LeaderboardService) publishBoard(ctx context.Context, id string) {
+	if err := s.cacheRepo.PublishBoardChange(ctx, id); err != nil {
+		log.Printf("[Service] Error publishing change of board %s: %v", id, err)
+	}
+}
+
+// forgetBoard - Drop a cached definition, the next lookup reads Postgres
+func (s *LeaderboardService) forgetBoard(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.boards, id)
+}
+
+// GetBoard - Board definition by ID
+func (s *LeaderboardService) GetBoard(ctx context.Context, id string) (models.Leaderboard, error) {
+	return s.board(ctx, id)
+}
+
+// board - Lookup a board definition, cached per instance. A miss reads
+// Postgres since the board may have been created by another instance
+func (s *LeaderboardService) board(ctx context.Context, id string) (models.Leaderboard, error) {
+	s.mu.RLock()
+	b, ok := s.boards[id]
+	s.mu.RUnlock()
+	if ok {
+		return b, nil
+	}
+	board, err := s.boardRepo.GetBoard(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Leaderboard{}, ErrBoardNotFound
 	}
+	if err != nil {
+		return models.Leaderboard{}, err
+	}
+	s.mu.Lock()
+	s.boards[board.ID] = *board
+	s.mu.Unlock()
+	return *board, nil
 }
 
 // GetLeaderboard - Returns paginated leaderboard from Redis
-func (s *LeaderboardService) GetLeaderboard(ctx context.Context, limit, offset int64) ([]models.RankedUser, int64, error) {
-	users, err := s.cacheRepo.GetLeaderboard(ctx, limit, offset)
+// Windowed periods only contain players updated within the current window.
+// With a region, ranks are regional and global ranks are attached.
+// While Redis is down all-time pages are ranked by Postgres and marked degraded
+func (s *LeaderboardService) GetLeaderboard(ctx context.Context, boardID string, period models.Period, region string, limit, offset int64) (*models.Page, int64, error) {
+	board, key, err := s.pageKey(ctx, boardID, period, region)
 	if err != nil {
 		return nil, 0, err
 	}
-	total, err := s.cacheRepo.GetTotalUsers(ctx)
+	var page *models.Page
+	var total int64
+	ok, err := s.withRedis(func() error {
+		var err error
+		page, err = s.cacheRepo.GetLeaderboard(ctx, boardID, key, board.RankMode, limit, offset)
+		if err != nil {
+			return err
+		}
+		page, total, err = s.finishPage(ctx, board, key, region, page)
+		return err
+	})
+	if ok {
+		return page, total, err
+	}
+	// Postgres has no time-windowed sets
+	if period != models.PeriodAllTime {
+		return nil, 0, ErrDegraded
+	}
+	users, total, err := s.userRepo.GetRankedPage(ctx, boardID, board.RankMode, board.TieBreak, region, limit, offset)
 	if err != nil {
 		return nil, 0, err
 	}
-	return users, total, nil
+	return &models.Page{Users: users, Degraded: true}, total, nil
+}
+
+// GetLeaderboardAfter - Cursor based page, stable under concurrent updates
+func (s *LeaderboardService) GetLeaderboardAfter(ctx context.Context, boardID string, period models.Period, region string, cursor models.Cursor, limit int64) (*models.Page, int64, error) {
+	board, key, err := s.pageKey(ctx, boardID, period, region)
+	if err != nil {
+		return nil, 0, err
+	}
+	var page *models.Page
+	var total int64
+	ok, err := s.withRedis(func() error {
+		var err error
+		page, err = s.cacheRepo.GetLeaderboardAfter(ctx, boardID, key, board.RankMode, cursor, limit)
+		if err != nil {
+			return err
+		}
+		page, total, err = s.finishPage(ctx, board, key, region, page)
+		return err
+	})
+	if !ok {
+		// Cursors hold sorted set scores, offset pages work in degraded mode
+		return nil, 0, ErrDegraded
+	}
+	return page, total, err
+}
+
+// pageKey - Sorted set a page is read from
+func (s *LeaderboardService) pageKey(ctx context.Context, boardID string, period models.Period, region string) (models.Leaderboard, string, error) {
+	board, err := s.board(ctx, boardID)
+	if err != nil {
+		return board, "", err
+	}
+	if region == "" {
+		return board, repository.PeriodKey(boardID, period, period.Window(time.Now())), nil
+	}
+	if !regionPattern.MatchString(region) {
+		return board, "", ErrInvalidRegion
+	}
+	if boardID != models.DefaultBoard || period != models.PeriodAllTime {
+		return board, "", ErrRegionUnsupported
+	}
+	return board, repository.RegionKey(region), nil
+}
+
+// finishPage - Attach global ranks to regional pages and count the set
+func (s *LeaderboardService) finishPage(ctx context.Context, board models.Leaderboard, key, region string, page *models.Page) (*models.Page, int64, error) {
+	if region != "" {
+		if err := s.cacheRepo.AttachGlobalRanks(ctx, board.RankMode, page.Users); err != nil {
+			return nil, 0, err
+		}
+		for i := range page.Users {
+			page.Users[i].Region = region
+		}
+	}
+	total, err := s.cacheRepo.GetTotalUsers(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return page, total, nil
 }
 
 // SearchUsers - Search + get live ranks
-func (s *LeaderboardService) SearchUsers(ctx context.Context, query string) ([]models.RankedUser, error) {
+func (s *LeaderboardService) SearchUsers(ctx context.Context, boardID, query string) ([]models.RankedUser, error) {
+	board, err := s.board(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
 	// Search in PostgreSQL
 	users, err := s.userRepo.SearchUsers(ctx, query)
 	if err != nil {
@@ -50,74 +287,336 @@ func (s *LeaderboardService) SearchUsers(ctx context.Context, query string) ([]m
 	// Get live ranks from Redis
 	rankedUsers := make([]models.RankedUser, 0, len(users))
 	for _, u := range users {
-		rank, rating, err := s.cacheRepo.GetRank(ctx, u.ID)
-		if err != nil {
-			// Fallback to DB rating
-			rank = 0
-			rating = u.Rating
-		}
-		rankedUsers = append(rankedUsers, models.RankedUser{
-			Rank:     rank,
-			ID:       u.ID,
-			Username: u.Username,
-			Rating:   rating,
+		var ranked *models.RankedUser
+		ok, err := s.withRedis(func() error {
+			var err error
+			ranked, err = s.cacheRepo.GetRank(ctx, boardID, board.RankMode, u.ID)
+			return err
 		})
+		if !ok || err != nil {
+			// Fallback to DB rating
+			ranked = &models.RankedUser{ID: u.ID, Rating: s.fallbackRating(boardID, u)}
+		}
+		ranked.Username = u.Username
+		if boardID == models.DefaultBoard {
+			ranked.Region = u.Region
+		}
+		rankedUsers = append(rankedUsers, *ranked)
 	}
 	return rankedUsers, nil
 }
 
 // GetUserRank - Get single user's rank
-func (s *LeaderboardService) GetUserRank(ctx context.Context, userID int64) (*models.RankedUser, error) {
+// Ranked by Postgres and marked degraded while Redis is down
+func (s *LeaderboardService) GetUserRank(ctx context.Context, boardID string, userID int64) (*models.RankedUser, error) {
+	board, err := s.board(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
 	user, err := s.userRepo.GetUserByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	rank, rating, err := s.cacheRepo.GetRank(ctx, userID)
+	var ranked *models.RankedUser
+	ok, err := s.withRedis(func() error {
+		var err error
+		ranked, err = s.cacheRepo.GetRank(ctx, boardID, board.RankMode, userID)
+		return err
+	})
+	switch {
+	case !ok:
+		ranked, err = s.userRepo.GetRankedUser(ctx, boardID, board.RankMode, board.TieBreak, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Not on this board yet
+			ranked, err = &models.RankedUser{ID: user.ID}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ranked.Degraded = true
+	case err != nil:
+		ranked = &models.RankedUser{ID: user.ID, Rating: s.fallbackRating(boardID, *user)}
+	}
+	ranked.Username = user.Username
+	if boardID == models.DefaultBoard {
+		ranked.Region = user.Region
+	}
+	return ranked, nil
+}
+
+// GetAroundUser - Neighbourhood of a user, read atomically from Redis
+func (s *LeaderboardService) GetAroundUser(ctx context.Context, boardID string, userID, radius int64) ([]models.RankedUser, error) {
+	board, err := s.board(ctx, boardID)
 	if err != nil {
-		rating = user.Rating
-		rank = 0
+		return nil, err
 	}
-	return &models.RankedUser{
-		Rank:     rank,
-		ID:       user.ID,
-		Username: user.Username,
-		Rating:   rating,
-	}, nil
+	return s.cacheRepo.GetAroundUser(ctx, boardID, board.RankMode, userID, radius)
+}
+
+// SetRegion - Move a user to a region of the global board, empty clears it
+func (s *LeaderboardService) SetRegion(ctx context.Context, userID int64, region string) error {
+	if region != "" && !regionPattern.MatchString(region) {
+		return ErrInvalidRegion
+	}
+	found, err := s.userRepo.SetRegion(ctx, userID, region)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+	return s.cacheRepo.SetRegion(ctx, userID, region)
+}
+
+// fallbackRating - users.rating only describes the global board
+func (s *LeaderboardService) fallbackRating(boardID string, user models.User) int {
+	if boardID == models.DefaultBoard {
+		return user.Rating
+	}
+	return 0
 }
 
 // UpdateRating - Redis first, then async DB!
-func (s *LeaderboardService) UpdateRating(ctx context.Context, userID int64, newRating int) error {
-	version := time.Now().UnixNano() // Use timestamp as version
-	// 1. Update Redis FIRST (fast path, instant feedback)
-	err := s.cacheRepo.UpdateRating(ctx, userID, newRating, version)
+// With expectedVersion set the update only applies while that version is
+// stored. Returns the rating and version stored afterwards, the current ones
+// with repository.ErrStaleUpdate or repository.ErrVersionMismatch, and
+// whether Redis was down and the update went straight to Postgres.
+func (s *LeaderboardService) UpdateRating(ctx context.Context, boardID string, userID int64, newRating int, expectedVersion *int64) (models.PlayerState, bool, error) {
+	board, err := s.board(ctx, boardID)
 	if err != nil {
+		return models.PlayerState{}, false, err
+	}
+	update := models.RatingUpdate{
+		BoardID:    boardID,
+		UserID:     userID,
+		Rating:     newRating,
+		AchievedAt: time.Now(),
+		Source:     models.SourceUpdate,
+	}
+	var state models.PlayerState
+	ok, err := s.withRedis(func() error {
+		update.Version, err = s.versions.Next(ctx)
+		if err != nil {
+			return err
+		}
+		// 1. Update Redis FIRST (fast path, instant feedback)
+		state, err = s.cacheRepo.UpdateRating(ctx, update, board.TieBreak, expectedVersion)
 		return err
+	})
+	if !ok {
+		state, err = s.writeThrough(ctx, update, expectedVersion)
+		return state, true, err
 	}
-	// 2. Queue for async DB write (non-blocking)
-	select {
-	case s.updateQueue <- models.RatingUpdate{
-		UserID:  userID,
-		Rating:  newRating,
-		Version: version,
-	}:
-	default:
-		log.Printf("[Service] Warning: update queue full!")
+	if err != nil {
+		// Nothing was written, nothing to persist
+		return state, false, err
+	}
+	// 2. Queue for async DB write (durable)
+	degraded, err := s.persist(ctx, update)
+	return state, degraded, err
+}
+
+// writeThrough - Degraded mode write of an update Redis may not have, straight
+// to Postgres with a version from the local clock, which the shared clock was
+// seeded past at startup. Conditional updates need the Lua check and are
+// refused.
+func (s *LeaderboardService) writeThrough(ctx context.Context, update models.RatingUpdate, expectedVersion *int64) (models.PlayerState, error) {
+	if expectedVersion != nil {
+		return models.PlayerState{}, ErrDegraded
+	}
+	// Redis checks the user exists, do it here or the board rating hits the FK
+	if _, err := s.userRepo.GetUserByID(ctx, update.UserID); errors.Is(err, sql.ErrNoRows) {
+		return models.PlayerState{}, ErrUserNotFound
+	} else if err != nil {
+		return models.PlayerState{}, err
+	}
+	update.Version, _ = s.fallbackVersions.Next(ctx)
+	if err := s.writePostgres(ctx, update); err != nil {
+		return models.PlayerState{}, err
+	}
+	return models.PlayerState{UserID: update.UserID, Rating: update.Rating, Version: update.Version}, nil
+}
+
+// writePostgres - Write updates without the DB writer. Redis has not seen
+// them or cannot be told to persist them, so it stays off until recovered.
+func (s *LeaderboardService) writePostgres(ctx context.Context, updates ...models.RatingUpdate) error {
+	s.tripBreaker()
+	return s.userRepo.BatchUpdateRatings(ctx, updates)
+}
+
+// A delta is read-modify-write in one script, but its version is taken in a
+// separate round trip and can lose to a concurrent write, retry with a new one
+const deltaRetries = 3
+
+// UpdateRatingBy - Relative change applied atomically in Redis, then async DB
+// The result is clamped to the allowed rating range. Returns the new rating
+// and the version assigned to the update. A delta whose version lost the race
+// to a newer write is retried with a fresh version; repository.ErrStaleUpdate
+// with the stored rating and version if it keeps losing. The change is
+// computed from the rating in Redis, ErrDegraded while it is down or not yet
+// resynced.
+func (s *LeaderboardService) UpdateRatingBy(ctx context.Context, boardID string, userID int64, delta int) (int, int64, error) {
+	board, err := s.board(ctx, boardID)
+	if err != nil {
+		return 0, 0, err
+	}
+	update := models.RatingUpdate{
+		BoardID:    boardID,
+		UserID:     userID,
+		AchievedAt: time.Now(),
+		Source:     models.SourceDelta,
+	}
+	if s.resyncPending() {
+		return 0, 0, ErrDegraded
+	}
+	var state models.PlayerState
+	for attempt := 0; attempt < deltaRetries; attempt++ {
+		ok, err := s.withRedis(func() error {
+			update.Version, err = s.versions.Next(ctx)
+			if err != nil {
+				return err
+			}
+			state, err = s.cacheRepo.UpdateRatingBy(ctx, update, delta, board.TieBreak)
+			return err
+		})
+		if !ok {
+			return 0, 0, ErrDegraded
+		}
+		if errors.Is(err, repository.ErrStaleUpdate) {
+			// Not added, nothing to persist
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		update.Rating = state.Rating
+		if err := s.enqueue(ctx, update); err != nil {
+			return 0, 0, err
+		}
+		return update.Rating, update.Version, nil
+	}
+	return state.Rating, state.Version, repository.ErrStaleUpdate
+}
+
+// enqueue - Hand applied updates to the DB writer. Once this returns they
+// survive a crash; an error means Redis has them but Postgres may not.
+func (s *LeaderboardService) enqueue(ctx context.Context, updates ...models.RatingUpdate) error {
+	_, err := s.persist(ctx, updates...)
+	return err
+}
+
+// persist - enqueue, true if the queue was unreachable and the updates were
+// written to Postgres directly instead
+func (s *LeaderboardService) persist(ctx context.Context, updates ...models.RatingUpdate) (bool, error) {
+	if len(updates) == 0 {
+		return false, nil
+	}
+	ok, err := s.withRedis(func() error {
+		return s.updateQueue.Push(ctx, updates...)
+	})
+	if !ok {
+		return true, s.writePostgres(ctx, updates...)
+	}
+	if err != nil {
+		log.Printf("[Service] Error queueing %d updates: %v", len(updates), err)
+		return false, err
+	}
+	return false, nil
+}
+
+// OnChange - Register a listener for rating changes applied by any instance
+// Listeners run on the change feed goroutine and must not block
+func (s *LeaderboardService) OnChange(fn func(models.RatingEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// ListenChanges - Feed local listeners from the shared change channel, so
+// subscribers see updates applied on other replicas too. Board changes made
+// elsewhere drop the cached definition.
+func (s *LeaderboardService) ListenChanges(ctx context.Context) {
+	log.Println("[Service] Listening for rating changes")
+	for {
+		err := s.cacheRepo.ListenChanges(ctx, s.notify, s.forgetBoard)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[Service] Change feed error: %v, retrying", err)
+		// Board changes may have been missed meanwhile
+		s.mu.Lock()
+		s.boards = map[string]models.Leaderboard{}
+		s.mu.Unlock()
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return
+		}
 	}
-	return nil
 }
 
-// WarmCache - Load all users from DB to Redis at startup
+func (s *LeaderboardService) notify(event models.RatingEvent) {
+	s.mu.RLock()
+	listeners := s.listeners
+	s.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
+
+func maxUserVersion(users []models.User) int64 {
+	var v int64
+	for _, u := range users {
+		if u.Version > v {
+			v = u.Version
+		}
+	}
+	return v
+}
+
+// WarmCache - Load boards and all ratings from DB to Redis at startup
 func (s *LeaderboardService) WarmCache(ctx context.Context) error {
 	log.Println("[Service] Warming cache...")
 	start := time.Now()
+	boards, err := s.boardRepo.GetBoards(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	for _, b := range boards {
+		s.boards[b.ID] = b
+	}
+	s.mu.Unlock()
 	users, err := s.userRepo.GetAllUsers(ctx)
 	if err != nil {
 		return err
 	}
-	err = s.cacheRepo.WarmCache(ctx, users)
+	global, _ := s.board(ctx, models.DefaultBoard)
+	err = s.cacheRepo.WarmCache(ctx, models.DefaultBoard, global.TieBreak, users)
 	if err != nil {
 		return err
 	}
-	log.Printf("[Service] Cache warmed with %d users in %v", len(users), time.Since(start))
+	maxVersion := maxUserVersion(users)
+	for _, b := range boards {
+		if b.ID == models.DefaultBoard {
+			continue
+		}
+		entries, err := s.boardRepo.GetBoardUsers(ctx, b.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.cacheRepo.WarmCache(ctx, b.ID, b.TieBreak, entries); err != nil {
+			return err
+		}
+		if v := maxUserVersion(entries); v > maxVersion {
+			maxVersion = v
+		}
+	}
+	// Versions written before the shared clock came from app server clocks
+	if err := s.cacheRepo.SeedVersion(ctx, maxVersion); err != nil {
+		return err
+	}
+	s.fallbackVersions.seed(maxVersion)
+	log.Printf("[Service] Cache warmed with %d users and %d boards in %v", len(users), len(boards), time.Since(start))
 	return nil
 }
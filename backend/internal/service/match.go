@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+var (
+	ErrInvalidMatch  = errors.New("invalid match")
+	ErrMatchConflict = errors.New("players were updated concurrently, retry the match")
+)
+
+// Concurrent writes to the same players make ApplyMatch fail, re-read and retry
+const matchRetries = 3
+
+// ReportMatch - Rate a finished match and apply every player's new rating at once
+// Rates from the ratings in Redis, ErrDegraded while it is down or not yet
+// resynced
+func (s *LeaderboardService) ReportMatch(ctx context.Context, boardID string, teams []models.MatchTeam) ([]models.MatchResult, error) {
+	board, err := s.board(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	scoreA, err := matchScore(teams)
+	if err != nil {
+		return nil, err
+	}
+	if s.resyncPending() {
+		return nil, ErrDegraded
+	}
+	ids := append(append([]int64{}, teams[0].Players...), teams[1].Players...)
+	sizeA := len(teams[0].Players)
+	for attempt := 0; attempt < matchRetries; attempt++ {
+		var states []models.PlayerState
+		var updated []models.PlayerState
+		var version int64
+		var applied bool
+		now := time.Now()
+		ok, err := s.withRedis(func() error {
+			states, err = s.cacheRepo.GetPlayerStates(ctx, boardID, ids)
+			if err != nil {
+				return err
+			}
+			newA, newB := s.ratingSystem.Rate(states[:sizeA], states[sizeA:], scoreA)
+			updated = append(newA, newB...)
+			version, err = s.versions.Next(ctx)
+			if err != nil {
+				return err
+			}
+			applied, err = s.cacheRepo.ApplyMatch(ctx, boardID, board.TieBreak, version, now, states, updated)
+			return err
+		})
+		if !ok {
+			return nil, ErrDegraded
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !applied {
+			continue
+		}
+		results := make([]models.MatchResult, len(updated))
+		queued := make([]models.RatingUpdate, len(updated))
+		for i, p := range updated {
+			results[i] = models.MatchResult{
+				UserID:    p.UserID,
+				OldRating: states[i].Rating,
+				NewRating: p.Rating,
+				Delta:     p.Rating - states[i].Rating,
+				Version:   version,
+			}
+			if s.ratingSystem.Name() == "glicko2" {
+				results[i].Deviation = p.Deviation
+			}
+			queued[i] = models.RatingUpdate{
+				BoardID:    boardID,
+				UserID:     p.UserID,
+				Rating:     p.Rating,
+				Version:    version,
+				AchievedAt: now,
+				Deviation:  p.Deviation,
+				Volatility: p.Volatility,
+				Source:     models.SourceMatch,
+			}
+		}
+		if err := s.enqueue(ctx, queued...); err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+	return nil, ErrMatchConflict
+}
+
+// matchScore - Team A's score, checks the match is well formed
+func matchScore(teams []models.MatchTeam) (float64, error) {
+	if len(teams) != 2 {
+		return 0, fmt.Errorf("%w: exactly two teams required", ErrInvalidMatch)
+	}
+	seen := make(map[int64]bool)
+	for _, t := range teams {
+		if len(t.Players) == 0 {
+			return 0, fmt.Errorf("%w: empty team", ErrInvalidMatch)
+		}
+		for _, id := range t.Players {
+			if seen[id] {
+				return 0, fmt.Errorf("%w: player %d appears twice", ErrInvalidMatch, id)
+			}
+			seen[id] = true
+		}
+	}
+	switch {
+	case teams[0].Outcome == models.OutcomeWin && teams[1].Outcome == models.OutcomeLoss:
+		return 1, nil
+	case teams[0].Outcome == models.OutcomeLoss && teams[1].Outcome == models.OutcomeWin:
+		return 0, nil
+	case teams[0].Outcome == models.OutcomeDraw && teams[1].Outcome == models.OutcomeDraw:
+		return 0.5, nil
+	}
+	return 0, fmt.Errorf("%w: outcomes must be win/loss or draw/draw", ErrInvalidMatch)
+}
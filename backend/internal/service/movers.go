@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
+)
+
+var (
+	ErrInvalidWindow    = errors.New("window must be between 1h and 168h")
+	ErrInvalidDirection = errors.New("direction must be up or down")
+)
+
+// GetMovers - Biggest gainers (up) or losers (down) over the last window
+// Served from hourly buckets kept by the write path, so the span covered is
+// window rounded up to whole hours plus the current partial hour: 24h reads
+// 24h to 25h back. Movement is the summed rating change, not rank change;
+// ranks are not tracked per write. Decay and season resets do not count
+func (s *LeaderboardService) GetMovers(ctx context.Context, boardID string, window time.Duration, direction string, limit int64) ([]models.Mover, error) {
+	if _, err := s.board(ctx, boardID); err != nil {
+		return nil, err
+	}
+	if window < time.Hour || window > repository.MaxMoversWindow {
+		return nil, ErrInvalidWindow
+	}
+	if direction != "up" && direction != "down" {
+		return nil, ErrInvalidDirection
+	}
+	return s.cacheRepo.GetMovers(ctx, boardID, window, direction, limit)
+}
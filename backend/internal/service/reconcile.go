@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+var ErrReconcileRunning = errors.New("reconciliation already running")
+
+// reconcileChunkSize - Users compared per DB page and Redis round trip
+const reconcileChunkSize = 1000
+
+// Drift counters, summed over all runs, served on /debug/vars
+var reconcileMetrics = expvar.NewMap("reconcile")
+
+// ReconcileService - Finds and repairs drift between Redis and Postgres on
+// every board. The version decides which side is right: an older Redis
+// entry is rewritten from Postgres, a newer one is requeued for the DB writer.
+type ReconcileService struct {
+	leaderboard *LeaderboardService
+	settle      time.Duration // Time for queued DB writes to land before Postgres counts as stale
+
+	mu      sync.Mutex
+	running bool
+	done    chan struct{} // Closed when the running run finishes
+	last    *models.ReconcileReport
+}
+
+func NewReconcileService(leaderboard *LeaderboardService, settle time.Duration) *ReconcileService {
+	return &ReconcileService{leaderboard: leaderboard, settle: settle}
+}
+
+// Status - Whether a run is in progress and the report of the last one (nil
+// before the first run)
+func (s *ReconcileService) Status() (bool, *models.ReconcileReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running, s.last
+}
+
+// Run - Reconcile now and wait for the report
+func (s *ReconcileService) Run(ctx context.Context) (*models.ReconcileReport, error) {
+	if !s.begin() {
+		return nil, ErrReconcileRunning
+	}
+	return s.finish(ctx)
+}
+
+// Start - Reconcile in the background
+func (s *ReconcileService) Start() error {
+	if !s.begin() {
+		return ErrReconcileRunning
+	}
+	go s.finish(context.Background())
+	return nil
+}
+
+// Resync - Reconcile now and wait for the report. Unlike Run it waits for a
+// run already in progress, which may have read Redis too early, and then
+// starts its own
+func (s *ReconcileService) Resync(ctx context.Context) (*models.ReconcileReport, error) {
+	for !s.begin() {
+		s.mu.Lock()
+		done := s.done
+		s.mu.Unlock()
+		if done == nil {
+			continue // Finished in between
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return s.finish(ctx)
+}
+
+func (s *ReconcileService) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return false
+	}
+	s.running = true
+	s.done = make(chan struct{})
+	return true
+}
+
+func (s *ReconcileService) finish(ctx context.Context) (*models.ReconcileReport, error) {
+	report := &models.ReconcileReport{StartedAt: time.Now()}
+	err := s.reconcile(ctx, report)
+	report.FinishedAt = time.Now()
+	if err != nil {
+		report.Error = err.Error()
+		log.Printf("[Reconcile] Error: %v", err)
+	}
+	log.Printf("[Reconcile] Scanned %d users in %v, drift: %d missing in Redis, %d Redis stale, %d Postgres stale, %d conflicts, %d orphans",
+		report.Scanned, report.FinishedAt.Sub(report.StartedAt), report.MissingInRedis, report.RedisStale,
+		report.PostgresStale, report.Conflicts, report.Orphans)
+	recordReconcile(report)
+	s.mu.Lock()
+	s.running = false
+	s.last = report
+	close(s.done)
+	s.done = nil
+	s.mu.Unlock()
+	return report, err
+}
+
+func recordReconcile(report *models.ReconcileReport) {
+	reconcileMetrics.Add("runs", 1)
+	reconcileMetrics.Add("scanned", report.Scanned)
+	reconcileMetrics.Add("missing_in_redis", report.MissingInRedis)
+	reconcileMetrics.Add("redis_stale", report.RedisStale)
+	reconcileMetrics.Add("postgres_stale", report.PostgresStale)
+	reconcileMetrics.Add("conflicts", report.Conflicts)
+	reconcileMetrics.Add("orphans", report.Orphans)
+	if report.Error != "" {
+		reconcileMetrics.Add("errors", 1)
+	}
+	drift := new(expvar.Int)
+	drift.Set(report.Drift())
+	reconcileMetrics.Set("last_drift", drift)
+}
+
+// reconcile - Every board in turn, the counts of the report are summed
+func (s *ReconcileService) reconcile(ctx context.Context, report *models.ReconcileReport) error {
+	boards, err := s.leaderboard.GetBoards(ctx)
+	if err != nil {
+		return err
+	}
+	for _, board := range boards {
+		if err := s.reconcileBoard(ctx, board, report); err != nil {
+			return fmt.Errorf("board %s: %w", board.ID, err)
+		}
+	}
+	return nil
+}
+
+// reconcileBoard - Walk the board's ratings in user id order, then requeue
+// what Postgres is behind on and check the board set for orphans
+func (s *ReconcileService) reconcileBoard(ctx context.Context, board models.Leaderboard, report *models.ReconcileReport) error {
+	var lastID int64
+	var ahead []*models.User // Redis newer than Postgres
+	for {
+		users, err := s.usersAfter(ctx, board.ID, lastID)
+		if err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			break
+		}
+		lastID = users[len(users)-1].ID
+		chunkAhead, err := s.reconcileChunk(ctx, board, users, report)
+		if err != nil {
+			return err
+		}
+		ahead = append(ahead, chunkAhead...)
+	}
+	if err := s.requeue(ctx, board.ID, ahead, report); err != nil {
+		return err
+	}
+	return s.countOrphans(ctx, board.ID, report)
+}
+
+// usersAfter - Next page of a board's ratings in Postgres
+func (s *ReconcileService) usersAfter(ctx context.Context, boardID string, afterID int64) ([]models.User, error) {
+	if boardID == models.DefaultBoard {
+		return s.leaderboard.userRepo.GetUsersAfter(ctx, afterID, reconcileChunkSize)
+	}
+	return s.leaderboard.boardRepo.GetBoardUsersAfter(ctx, boardID, afterID, reconcileChunkSize)
+}
+
+// versions - Postgres versions of the given users' ratings on a board
+func (s *ReconcileService) versions(ctx context.Context, boardID string, ids []int64) (map[int64]int64, error) {
+	if boardID == models.DefaultBoard {
+		return s.leaderboard.userRepo.GetVersions(ctx, ids)
+	}
+	return s.leaderboard.boardRepo.GetBoardVersions(ctx, boardID, ids)
+}
+
+// reconcileChunk - Repair Redis where Postgres is newer, returns the entries
+// where Redis is newer
+func (s *ReconcileService) reconcileChunk(ctx context.Context, board models.Leaderboard, users []models.User, report *models.ReconcileReport) ([]*models.User, error) {
+	ids := make([]int64, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	stored, err := s.leaderboard.cacheRepo.GetStoredRatings(ctx, board.ID, ids)
+	if err != nil {
+		return nil, err
+	}
+	var ahead []*models.User
+	for i, u := range users {
+		report.Scanned++
+		cached := stored[i]
+		switch {
+		case cached == nil || cached.Version < u.Version:
+			// Versioned write, loses to an update that lands meanwhile
+			applied, err := s.leaderboard.cacheRepo.RepairRating(ctx, board.ID, board.TieBreak, u)
+			if err != nil {
+				return nil, err
+			}
+			if !applied {
+				continue
+			}
+			if cached == nil {
+				report.MissingInRedis++
+			} else {
+				report.RedisStale++
+			}
+		case cached.Version > u.Version:
+			ahead = append(ahead, cached)
+		case cached.Rating != u.Rating:
+			report.Conflicts++
+			log.Printf("[Reconcile] User %d has rating %d in Redis but %d in Postgres, both at version %d",
+				u.ID, cached.Rating, u.Rating, u.Version)
+		}
+	}
+	return ahead, nil
+}
+
+// requeue - Let queued DB writes land, once per board, then requeue the
+// Redis ratings that Postgres is still behind on
+func (s *ReconcileService) requeue(ctx context.Context, boardID string, ahead []*models.User, report *models.ReconcileReport) error {
+	if len(ahead) == 0 {
+		return nil
+	}
+	select {
+	case <-time.After(s.settle):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	for start := 0; start < len(ahead); start += reconcileChunkSize {
+		chunk := ahead[start:min(start+reconcileChunkSize, len(ahead))]
+		if err := s.requeueChunk(ctx, boardID, chunk, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ReconcileService) requeueChunk(ctx context.Context, boardID string, ahead []*models.User, report *models.ReconcileReport) error {
+	ids := make([]int64, len(ahead))
+	for i, u := range ahead {
+		ids[i] = u.ID
+	}
+	versions, err := s.versions(ctx, boardID, ids)
+	if err != nil {
+		return err
+	}
+	updates := make([]models.RatingUpdate, 0, len(ahead))
+	for _, u := range ahead {
+		// Deleted meanwhile, or the write was just late
+		if v, ok := versions[u.ID]; !ok || v >= u.Version {
+			continue
+		}
+		updates = append(updates, models.RatingUpdate{
+			BoardID:    boardID,
+			UserID:     u.ID,
+			Rating:     u.Rating,
+			Version:    u.Version,
+			AchievedAt: u.AchievedAt,
+			Decayed:    u.Decayed,
+			Source:     models.SourceReconcile,
+		})
+	}
+	report.PostgresStale += int64(len(updates))
+	return s.leaderboard.enqueue(ctx, updates...)
+}
+
+// countOrphans - Board members without a rating in Postgres. Only reported,
+// removing them safely needs every set they might be in.
+func (s *ReconcileService) countOrphans(ctx context.Context, boardID string, report *models.ReconcileReport) error {
+	var cursor uint64
+	for {
+		ids, next, err := s.leaderboard.cacheRepo.ScanBoard(ctx, boardID, cursor, reconcileChunkSize)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			versions, err := s.versions(ctx, boardID, ids)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if _, ok := versions[id]; !ok {
+					report.Orphans++
+				}
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
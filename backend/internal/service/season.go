@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
+)
+
+var (
+	ErrSeasonActive    = errors.New("board already has an active season")
+	ErrSeasonNotActive = errors.New("season is not active")
+	ErrInvalidReset    = errors.New("invalid reset")
+)
+
+const (
+	// Players archived and reset per step when a season ends
+	seasonChunkSize = 1000
+	// How long an archive run owns its season without making progress before
+	// another instance takes over, see ResumeArchiving
+	archiveLease = 2 * time.Minute
+)
+
+type SeasonService struct {
+	seasonRepo  *repository.SeasonRepository
+	cacheRepo   *repository.CacheRepository
+	leaderboard *LeaderboardService
+}
+
+func NewSeasonService(
+	seasonRepo *repository.SeasonRepository,
+	cacheRepo *repository.CacheRepository,
+	leaderboard *LeaderboardService,
+) *SeasonService {
+	return &SeasonService{
+		seasonRepo:  seasonRepo,
+		cacheRepo:   cacheRepo,
+		leaderboard: leaderboard,
+	}
+}
+
+// StartSeason - Open a new season on a board
+func (s *SeasonService) StartSeason(ctx context.Context, boardID, name string) (*models.Season, error) {
+	if _, err := s.leaderboard.GetBoard(ctx, boardID); err != nil {
+		return nil, err
+	}
+	seasons, err := s.seasonRepo.GetSeasons(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	for _, season := range seasons {
+		if season.Status == models.SeasonActive {
+			return nil, ErrSeasonActive
+		}
+	}
+	return s.seasonRepo.CreateSeason(ctx, boardID, name)
+}
+
+// GetSeasons - All seasons of a board
+func (s *SeasonService) GetSeasons(ctx context.Context, boardID string) ([]models.Season, error) {
+	if _, err := s.leaderboard.GetBoard(ctx, boardID); err != nil {
+		return nil, err
+	}
+	return s.seasonRepo.GetSeasons(ctx, boardID)
+}
+
+// EndSeason - Close a season, then archive standings and soft reset in the
+// background; the board keeps serving reads and writes meanwhile. A run cut
+// short by a restart is picked up by ResumeArchiving.
+func (s *SeasonService) EndSeason(ctx context.Context, id int64, resetFactor float64, resetTarget int) (*models.Season, error) {
+	if resetFactor < 0 || resetFactor > 1 {
+		return nil, fmt.Errorf("%w: factor must be between 0 and 1", ErrInvalidReset)
+	}
+	// Resets land between the old rating and the target, keep both in range
+	if resetTarget < models.MinRating || resetTarget > models.MaxRating {
+		return nil, fmt.Errorf("%w: target must be between %d and %d", ErrInvalidReset, models.MinRating, models.MaxRating)
+	}
+	season, err := s.seasonRepo.GetSeason(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if season.Status != models.SeasonActive {
+		return nil, ErrSeasonNotActive
+	}
+	board, err := s.leaderboard.GetBoard(ctx, season.BoardID)
+	if err != nil {
+		return nil, err
+	}
+	season, err = s.seasonRepo.EndSeason(ctx, id, resetFactor, resetTarget, archiveLease)
+	if errors.Is(err, repository.ErrSeasonNotFound) {
+		return nil, ErrSeasonNotActive // Ended concurrently
+	}
+	if err != nil {
+		return nil, err
+	}
+	go s.archive(context.Background(), *season, board)
+	return season, nil
+}
+
+// ResumeArchiving - Continue archive runs whose instance stopped, from the
+// last archived chunk
+func (s *SeasonService) ResumeArchiving(ctx context.Context) error {
+	seasons, err := s.seasonRepo.ClaimArchiving(ctx, archiveLease)
+	if err != nil {
+		return err
+	}
+	for _, season := range seasons {
+		board, err := s.leaderboard.GetBoard(ctx, season.BoardID)
+		if err != nil {
+			log.Printf("[Season] Error resuming season %d: %v", season.ID, err)
+			continue
+		}
+		log.Printf("[Season] Resuming archive of season %d", season.ID)
+		go s.archive(context.Background(), season, board)
+	}
+	return nil
+}
+
+// archive - Snapshot the board, copy final standings to Postgres and apply
+// the soft reset, one chunk at a time
+func (s *SeasonService) archive(ctx context.Context, season models.Season, board models.Leaderboard) {
+	start := time.Now()
+	key := repository.BoardKey(board.ID) + ":season:" + strconv.FormatInt(season.ID, 10)
+	status := models.SeasonArchived
+	total, err := s.archiveSnapshot(ctx, season, board, key)
+	if err != nil {
+		log.Printf("[Season] Error archiving season %d: %v", season.ID, err)
+		status = models.SeasonFailed
+	}
+	if err := s.cacheRepo.DeleteSnapshot(ctx, key); err != nil {
+		log.Printf("[Season] Error deleting snapshot %s: %v", key, err)
+	}
+	if err := s.seasonRepo.SetStatus(ctx, season.ID, status); err != nil {
+		log.Printf("[Season] Error updating season %d: %v", season.ID, err)
+	}
+	log.Printf("[Season] Season %d %s with %d players in %v", season.ID, status, total, time.Since(start))
+}
+
+func (s *SeasonService) archiveSnapshot(ctx context.Context, season models.Season, board models.Leaderboard, key string) (int64, error) {
+	offset, err := s.resumeOffset(ctx, season.ID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.prepareSnapshot(ctx, &season, board, key, offset); err != nil {
+		return offset, err
+	}
+	for {
+		page, err := s.cacheRepo.GetLeaderboard(ctx, board.ID, key, board.RankMode, seasonChunkSize, offset)
+		if err != nil {
+			return offset, err
+		}
+		if len(page.Users) == 0 {
+			return offset, nil
+		}
+		if err := s.seasonRepo.InsertStandings(ctx, season.ID, offset, page.Users); err != nil {
+			return offset, err
+		}
+		if season.ResetFactor > 0 {
+			resets := make([]models.RatingUpdate, len(page.Users))
+			for i, u := range page.Users {
+				resets[i] = models.RatingUpdate{UserID: u.ID, Rating: season.SoftReset(u.Rating), Source: models.SourceSeasonReset}
+			}
+			if err := s.leaderboard.ResetRatings(ctx, board.ID, season.ResetVersion, resets); err != nil {
+				return offset, err
+			}
+		}
+		offset += int64(len(page.Users))
+		if err := s.seasonRepo.RenewLease(ctx, season.ID, archiveLease); err != nil {
+			return offset, err
+		}
+	}
+}
+
+// resumeOffset - Where to continue archiving. The last archived chunk is
+// redone, its reset may not have been applied; both steps are idempotent
+func (s *SeasonService) resumeOffset(ctx context.Context, seasonID int64) (int64, error) {
+	archived, err := s.seasonRepo.CountStandings(ctx, seasonID)
+	if err != nil || archived == 0 {
+		return 0, err
+	}
+	return (archived - 1) / seasonChunkSize * seasonChunkSize, nil
+}
+
+// prepareSnapshot - Take the reset version and the snapshot on the first
+// run, a resumed run keeps both
+func (s *SeasonService) prepareSnapshot(ctx context.Context, season *models.Season, board models.Leaderboard, key string, offset int64) error {
+	if season.ResetVersion == 0 {
+		// Taken before the snapshot, so updates landing after it are newer than
+		// the reset and are kept instead of overwritten from the snapshot rating
+		version, err := s.leaderboard.versions.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if err := s.seasonRepo.SetResetVersion(ctx, season.ID, version); err != nil {
+			return err
+		}
+		season.ResetVersion = version
+		return s.cacheRepo.SnapshotBoard(ctx, board.ID, key)
+	}
+	exists, err := s.cacheRepo.SnapshotExists(ctx, key)
+	if err != nil || exists {
+		return err
+	}
+	// Nothing archived from a lost snapshot yet, a new one is as good
+	if offset > 0 {
+		return fmt.Errorf("snapshot %s lost after %d archived players", key, offset)
+	}
+	return s.cacheRepo.SnapshotBoard(ctx, board.ID, key)
+}
+
+// GetStandings - Archived final standings, offset or cursor paginated like the live board
+func (s *SeasonService) GetStandings(ctx context.Context, id int64, cursor *models.Cursor, limit, offset int64) (*models.Page, int64, error) {
+	if _, err := s.seasonRepo.GetSeason(ctx, id); err != nil {
+		return nil, 0, err
+	}
+	var rows []models.Standing
+	var err error
+	backward := false
+	if cursor != nil {
+		position, perr := strconv.ParseInt(cursor.Score, 10, 64)
+		if perr != nil {
+			return nil, 0, fmt.Errorf("%w: not a season cursor", models.ErrInvalidCursor)
+		}
+		backward = cursor.Prev
+		rows, err = s.seasonRepo.GetStandingsAfter(ctx, id, position, limit, backward)
+	} else {
+		rows, err = s.seasonRepo.GetStandings(ctx, id, limit, offset)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.seasonRepo.CountStandings(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	page := &models.Page{Users: make([]models.RankedUser, len(rows))}
+	for i, row := range rows {
+		page.Users[i] = row.RankedUser
+	}
+	if len(rows) > 0 {
+		first, last := rows[0], rows[len(rows)-1]
+		if backward || int64(len(rows)) == limit {
+			page.NextCursor = standingCursor(last, false)
+		}
+		if first.Position > 0 {
+			page.PrevCursor = standingCursor(first, true)
+		}
+	}
+	return page, total, nil
+}
+
+// standingCursor - Archived boards never change, so the position is the key
+func standingCursor(row models.Standing, prev bool) string {
+	return models.Cursor{
+		Score:  strconv.FormatInt(row.Position, 10),
+		Member: strconv.FormatInt(row.ID, 10),
+		Prev:   prev,
+	}.Encode()
+}
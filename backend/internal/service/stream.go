@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+)
+
+// MaxStreamWindow - Largest window a client can subscribe to
+const MaxStreamWindow = 100
+
+// streamBuffer - Undelivered events per subscriber before diffs get merged
+const streamBuffer = 8
+
+// WindowSubscription - One client watching ranks offset+1..offset+limit of the
+// all-time board
+type WindowSubscription struct {
+	BoardID string
+	Offset  int64
+	Limit   int64
+	events  chan models.WindowEvent
+	// Owned by the stream loop once registered
+	last  []models.RankedUser // window as the client last saw it
+	stale bool                // window must be compared even if the board is quiet
+}
+
+// Events - Diffs for this window, at most one per tick
+func (sub *WindowSubscription) Events() <-chan models.WindowEvent {
+	return sub.events
+}
+
+// RankSubscription - One client watching a single player's rank. Any update
+// on the board is a candidate, so being overtaken is noticed too.
+type RankSubscription struct {
+	BoardID string
+	UserID  int64
+	events  chan models.RankedUser // latest state only
+	// Owned by the stream loop once registered
+	last  models.RankedUser
+	stale bool
+}
+
+// Events - New rank and rating, sent only when either changed
+func (sub *RankSubscription) Events() <-chan models.RankedUser {
+	return sub.events
+}
+
+// LeaderboardStream - Fans rating changes from every instance out to live
+// window and rank subscribers. Changes only mark their board dirty; every tick
+// each dirty window or rank is read once and diffed, so a burst becomes a
+// single message.
+type LeaderboardStream struct {
+	leaderboard *LeaderboardService
+	interval    time.Duration
+
+	mu       sync.Mutex
+	dirty    map[string]bool // boards updated since the last tick
+	subs     map[*WindowSubscription]struct{}
+	rankSubs map[*RankSubscription]struct{}
+}
+
+func NewLeaderboardStream(leaderboard *LeaderboardService, interval time.Duration) *LeaderboardStream {
+	st := &LeaderboardStream{
+		leaderboard: leaderboard,
+		interval:    interval,
+		dirty:       make(map[string]bool),
+		subs:        make(map[*WindowSubscription]struct{}),
+		rankSubs:    make(map[*RankSubscription]struct{}),
+	}
+	leaderboard.OnChange(st.markDirty)
+	return st
+}
+
+func (st *LeaderboardStream) markDirty(event models.RatingEvent) {
+	st.mu.Lock()
+	st.dirty[event.BoardID] = true
+	st.mu.Unlock()
+}
+
+// Subscribe - Register a window, returns the snapshot to send first
+func (st *LeaderboardStream) Subscribe(ctx context.Context, boardID string, offset, limit int64) (*WindowSubscription, models.WindowEvent, error) {
+	if limit > MaxStreamWindow {
+		limit = MaxStreamWindow
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	users, err := st.window(ctx, boardID, offset, limit)
+	if err != nil {
+		return nil, models.WindowEvent{}, err
+	}
+	sub := &WindowSubscription{
+		BoardID: boardID,
+		Offset:  offset,
+		Limit:   limit,
+		events:  make(chan models.WindowEvent, streamBuffer),
+		last:    users,
+		stale:   true, // Updates between the read and now are not marked yet
+	}
+	st.mu.Lock()
+	st.subs[sub] = struct{}{}
+	st.mu.Unlock()
+	return sub, models.WindowEvent{
+		Type:    models.WindowSnapshot,
+		BoardID: boardID,
+		Offset:  offset,
+		Limit:   limit,
+		Users:   users,
+	}, nil
+}
+
+// Unsubscribe - Stop sending to a window
+func (st *LeaderboardStream) Unsubscribe(sub *WindowSubscription) {
+	st.mu.Lock()
+	delete(st.subs, sub)
+	st.mu.Unlock()
+}
+
+// SubscribeRank - Register a player, returns their current rank
+func (st *LeaderboardStream) SubscribeRank(ctx context.Context, boardID string, userID int64) (*RankSubscription, *models.RankedUser, error) {
+	current, err := st.leaderboard.GetUserRank(ctx, boardID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	sub := &RankSubscription{
+		BoardID: boardID,
+		UserID:  userID,
+		events:  make(chan models.RankedUser, 1),
+		last:    *current,
+		stale:   true,
+	}
+	st.mu.Lock()
+	st.rankSubs[sub] = struct{}{}
+	st.mu.Unlock()
+	return sub, current, nil
+}
+
+// UnsubscribeRank - Stop sending to a rank subscriber
+func (st *LeaderboardStream) UnsubscribeRank(sub *RankSubscription) {
+	st.mu.Lock()
+	delete(st.rankSubs, sub)
+	st.mu.Unlock()
+}
+
+func (st *LeaderboardStream) window(ctx context.Context, boardID string, offset, limit int64) ([]models.RankedUser, error) {
+	page, _, err := st.leaderboard.GetLeaderboard(ctx, boardID, models.PeriodAllTime, "", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return page.Users, nil
+}
+
+func (st *LeaderboardStream) Start(ctx context.Context) {
+	ticker := time.NewTicker(st.interval)
+	defer ticker.Stop()
+	log.Printf("[Stream] Started - interval: %v", st.interval)
+	for {
+		select {
+		case <-ticker.C:
+			st.tick(ctx)
+		case <-ctx.Done():
+			log.Println("[Stream] Stopped")
+			return
+		}
+	}
+}
+
+type windowKey struct {
+	boardID       string
+	offset, limit int64
+}
+
+// tick - Push what changed on the dirty boards since the last tick
+func (st *LeaderboardStream) tick(ctx context.Context) {
+	st.mu.Lock()
+	dirty := st.dirty
+	st.dirty = make(map[string]bool)
+	subs := make([]*WindowSubscription, 0, len(st.subs))
+	for sub := range st.subs {
+		subs = append(subs, sub)
+	}
+	rankSubs := make([]*RankSubscription, 0, len(st.rankSubs))
+	for sub := range st.rankSubs {
+		rankSubs = append(rankSubs, sub)
+	}
+	st.mu.Unlock()
+	st.sendWindows(ctx, dirty, subs)
+	st.sendRanks(ctx, dirty, rankSubs)
+}
+
+// sendWindows - Read every affected window once, send each subscriber its diff
+func (st *LeaderboardStream) sendWindows(ctx context.Context, dirty map[string]bool, subs []*WindowSubscription) {
+	windows := make(map[windowKey][]models.RankedUser)
+	failed := make(map[windowKey]bool)
+	for _, sub := range subs {
+		if !sub.stale && !dirty[sub.BoardID] {
+			continue
+		}
+		key := windowKey{sub.BoardID, sub.Offset, sub.Limit}
+		if failed[key] {
+			continue
+		}
+		users, ok := windows[key]
+		if !ok {
+			var err error
+			users, err = st.window(ctx, sub.BoardID, sub.Offset, sub.Limit)
+			if err != nil {
+				log.Printf("[Stream] Error reading board %s: %v", sub.BoardID, err)
+				failed[key] = true
+				sub.stale = true
+				continue
+			}
+			windows[key] = users
+		}
+		event := diffWindow(sub, users)
+		if event.Empty() {
+			sub.stale = false
+			continue
+		}
+		select {
+		case sub.events <- event:
+			sub.last = users
+			sub.stale = false
+		default:
+			// Slow client, the next diff is taken against what it last got
+			sub.stale = true
+		}
+	}
+}
+
+type rankKey struct {
+	boardID string
+	userID  int64
+}
+
+// sendRanks - Re-rank every watched player on a dirty board, send changes
+func (st *LeaderboardStream) sendRanks(ctx context.Context, dirty map[string]bool, subs []*RankSubscription) {
+	ranks := make(map[rankKey]*models.RankedUser)
+	for _, sub := range subs {
+		if !sub.stale && !dirty[sub.BoardID] {
+			continue
+		}
+		key := rankKey{sub.BoardID, sub.UserID}
+		ranked, ok := ranks[key]
+		if !ok {
+			ranked = st.rank(ctx, sub.BoardID, sub.UserID)
+			ranks[key] = ranked
+		}
+		if ranked == nil {
+			continue
+		}
+		sub.stale = false
+		u := *ranked
+		u.Username = sub.last.Username
+		if u.Rank == sub.last.Rank && u.Rating == sub.last.Rating && u.Decayed == sub.last.Decayed {
+			continue
+		}
+		// Only the latest state matters, replace one the client has not read
+		select {
+		case <-sub.events:
+		default:
+		}
+		sub.events <- u
+		sub.last = u
+	}
+}
+
+// rank - Live rank from Redis, nil if the player is not on the board
+func (st *LeaderboardStream) rank(ctx context.Context, boardID string, userID int64) *models.RankedUser {
+	board, err := st.leaderboard.board(ctx, boardID)
+	if err != nil {
+		return nil
+	}
+	ranked, err := st.leaderboard.cacheRepo.GetRank(ctx, boardID, board.RankMode, userID)
+	if err != nil {
+		return nil
+	}
+	return ranked
+}
+
+// diffWindow - Changes between what the subscriber has and the current window
+func diffWindow(sub *WindowSubscription, users []models.RankedUser) models.WindowEvent {
+	event := models.WindowEvent{
+		Type:    models.WindowDiff,
+		BoardID: sub.BoardID,
+		Offset:  sub.Offset,
+		Limit:   sub.Limit,
+	}
+	before := make(map[int64]models.RankedUser, len(sub.last))
+	for _, u := range sub.last {
+		before[u.ID] = u
+	}
+	for _, u := range users {
+		old, ok := before[u.ID]
+		switch {
+		case !ok:
+			event.Entered = append(event.Entered, u)
+		case old.Rank != u.Rank || old.Rating != u.Rating || old.Decayed != u.Decayed:
+			event.Moved = append(event.Moved, u)
+		}
+		delete(before, u.ID)
+	}
+	for _, u := range sub.last {
+		if _, ok := before[u.ID]; ok {
+			event.Left = append(event.Left, u.ID)
+		}
+	}
+	return event
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
+)
+
+var (
+	ErrTeamExists  = errors.New("team name already taken")
+	ErrTeamFull    = errors.New("team is full")
+	ErrNotInTeam   = errors.New("user is not a member of this team")
+	ErrInvalidTeam = errors.New("team name must not be empty")
+)
+
+type TeamService struct {
+	teamRepo  *repository.TeamRepository
+	userRepo  *repository.UserRepository
+	cacheRepo *repository.CacheRepository
+}
+
+func NewTeamService(
+	teamRepo *repository.TeamRepository,
+	userRepo *repository.UserRepository,
+	cacheRepo *repository.CacheRepository,
+) *TeamService {
+	return &TeamService{
+		teamRepo:  teamRepo,
+		userRepo:  userRepo,
+		cacheRepo: cacheRepo,
+	}
+}
+
+// GetTeams - All teams
+func (s *TeamService) GetTeams(ctx context.Context) ([]models.Team, error) {
+	return s.teamRepo.GetTeams(ctx)
+}
+
+// CreateTeam - New empty team, scored once members join
+func (s *TeamService) CreateTeam(ctx context.Context, name string, aggregate models.TeamAggregate) (*models.Team, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrInvalidTeam
+	}
+	team, created, err := s.teamRepo.CreateTeam(ctx, name, aggregate)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrTeamExists
+	}
+	if err := s.cacheRepo.SetTeam(ctx, *team, nil); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// UpdateAggregate - Change how a team is scored, rescored right away
+func (s *TeamService) UpdateAggregate(ctx context.Context, teamID int64, aggregate models.TeamAggregate) (*models.Team, error) {
+	team, err := s.teamRepo.UpdateAggregate(ctx, teamID, aggregate)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.teamRepo.GetMemberIDs(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cacheRepo.SetTeam(ctx, *team, members); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// JoinTeam - Add a user to a team, one team per user
+func (s *TeamService) JoinTeam(ctx context.Context, teamID, userID int64) error {
+	if _, err := s.teamRepo.GetTeam(ctx, teamID); err != nil {
+		return err
+	}
+	if _, err := s.userRepo.GetUserByID(ctx, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	current, err := s.teamRepo.GetTeamOf(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if current == teamID {
+		return nil
+	}
+	if current != 0 {
+		return repository.ErrAlreadyInTeam
+	}
+	added, err := s.teamRepo.AddMember(ctx, teamID, userID, models.MaxTeamSize)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return ErrTeamFull
+	}
+	return s.cacheRepo.JoinTeam(ctx, teamID, userID)
+}
+
+// LeaveTeam - Remove a user from a team
+func (s *TeamService) LeaveTeam(ctx context.Context, teamID, userID int64) error {
+	removed, err := s.teamRepo.RemoveMember(ctx, teamID, userID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrNotInTeam
+	}
+	return s.cacheRepo.LeaveTeam(ctx, teamID, userID)
+}
+
+// GetTeamLeaderboard - Teams ranked by their aggregate score
+func (s *TeamService) GetTeamLeaderboard(ctx context.Context, limit, offset int64) ([]models.RankedTeam, int64, error) {
+	return s.cacheRepo.GetTeamLeaderboard(ctx, limit, offset)
+}
+
+// WarmCache - Rebuild every team score from DB memberships
+// Runs after the user ratings are cached
+func (s *TeamService) WarmCache(ctx context.Context) error {
+	start := time.Now()
+	teams, err := s.teamRepo.GetTeams(ctx)
+	if err != nil {
+		return err
+	}
+	memberships, err := s.teamRepo.GetMemberships(ctx)
+	if err != nil {
+		return err
+	}
+	members := make(map[int64][]int64, len(teams))
+	for _, m := range memberships {
+		members[m.TeamID] = append(members[m.TeamID], m.UserID)
+	}
+	if err := s.cacheRepo.ClearTeams(ctx); err != nil {
+		return err
+	}
+	for _, team := range teams {
+		if err := s.cacheRepo.SetTeam(ctx, team, members[team.ID]); err != nil {
+			return err
+		}
+	}
+	log.Printf("[Team] Cache warmed with %d teams in %v", len(teams), time.Since(start))
+	return nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
+)
+
+// VersionSource - Hands out rating versions. A version must be larger than
+// every one handed out before, on every instance, or the Lua scripts and the
+// Postgres version guard take a newer update for a stale one.
+type VersionSource interface {
+	Next(ctx context.Context) (int64, error)
+}
+
+// NewVersionSource - Version source by name: "redis" (hybrid logical clock
+// shared by all instances) or "clock" (local time, single instance only)
+func NewVersionSource(name string, cacheRepo *repository.CacheRepository) (VersionSource, error) {
+	switch name {
+	case "redis":
+		return &redisVersions{cacheRepo: cacheRepo}, nil
+	case "clock":
+		return &clockVersions{}, nil
+	}
+	return nil, fmt.Errorf("unknown version source %q", name)
+}
+
+type redisVersions struct {
+	cacheRepo *repository.CacheRepository
+}
+
+func (v *redisVersions) Next(ctx context.Context) (int64, error) {
+	return v.cacheRepo.NextVersion(ctx)
+}
+
+// clockVersions - UnixNano, bumped past the last version if the clock did not
+// move or went backwards
+type clockVersions struct {
+	mu   sync.Mutex
+	last int64
+}
+
+func (v *clockVersions) Next(ctx context.Context) (int64, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	next := time.Now().UnixNano()
+	if next <= v.last {
+		next = v.last + 1
+	}
+	v.last = next
+	return next, nil
+}
+
+// seed - Never hand out maxVersion or anything below it
+func (v *clockVersions) seed(maxVersion int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if maxVersion > v.last {
+		v.last = maxVersion
+	}
+}
+
+// current - The last version handed out or seeded
+func (v *clockVersions) current() int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.last
+}
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"time"
 
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
 	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
 	"github.com/stilln0thing/matiks_leaderboard/internal/service"
 )
@@ -50,20 +51,8 @@ func (s *ScoreUpdater) updateRandomUsers(ctx context.Context) {
 		return
 	}
 	for _, userID := range userIDs {
-		user, err := s.userRepo.GetUserByID(ctx, userID)
-		if err != nil {
-			continue
-		}
-		// Random change: -100 to +100
+		// Random change: -100 to +100, applied atomically and clamped in Redis
 		delta := rand.Intn(201) - 100
-		newRating := user.Rating + delta
-		// Clamp to valid range
-		if newRating < 100 {
-			newRating = 100
-		}
-		if newRating > 5000 {
-			newRating = 5000
-		}
-		s.leaderboard.UpdateRating(ctx, userID, newRating)
+		s.leaderboard.UpdateRatingBy(ctx, models.DefaultBoard, userID, delta)
 	}
 }
@@ -9,61 +9,164 @@ import (
 	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
 )
 
+const (
+	// claimIdle - Pending entries older than this are taken over and retried
+	claimIdle = 30 * time.Second
+	// Attempts per write while Postgres reports transient errors
+	writeAttempts = 4
+	retryBackoff  = 200 * time.Millisecond // doubled per attempt
+)
+
 type DBWriter struct {
-	queue         chan models.RatingUpdate
+	queue         *repository.UpdateQueue
 	repo          *repository.UserRepository
+	deadLetters   *repository.DeadLetterRepository
+	consumer      string // Unique per instance within the consumer group
 	batchSize     int
 	flushInterval time.Duration
 }
 
-func NewDBWriter(repo *repository.UserRepository, queueSize, batchSize int, flushInterval time.Duration) *DBWriter {
+func NewDBWriter(
+	repo *repository.UserRepository,
+	queue *repository.UpdateQueue,
+	deadLetters *repository.DeadLetterRepository,
+	consumer string,
+	batchSize int,
+	flushInterval time.Duration,
+) *DBWriter {
 	return &DBWriter{
-		queue:         make(chan models.RatingUpdate, queueSize),
+		queue:         queue,
 		repo:          repo,
+		deadLetters:   deadLetters,
+		consumer:      consumer,
 		batchSize:     batchSize,
 		flushInterval: flushInterval,
 	}
 }
-func (w *DBWriter) Queue() chan<- models.RatingUpdate {
-	return w.queue
-}
+
 func (w *DBWriter) Start(ctx context.Context) {
-	batch := make([]models.RatingUpdate, 0, w.batchSize)
-	ticker := time.NewTicker(w.flushInterval)
-	defer ticker.Stop()
-	log.Printf("[DBWriter] Started - batch: %d, interval: %v", w.batchSize, w.flushInterval)
 	for {
+		err := w.queue.EnsureGroup(ctx)
+		if err == nil {
+			break
+		}
+		log.Printf("[DBWriter] Error creating consumer group: %v", err)
 		select {
-		case update := <-w.queue:
-			batch = append(batch, update)
-			if len(batch) >= w.batchSize {
-				w.flush(ctx, batch)
-				batch = batch[:0]
-			}
-		case <-ticker.C:
-			if len(batch) > 0 {
-				w.flush(ctx, batch)
-				batch = batch[:0]
-			}
+		case <-time.After(time.Second):
 		case <-ctx.Done():
-			// Flush remaining on shutdown
-			if len(batch) > 0 {
-				w.flush(context.Background(), batch)
-			}
+			return
+		}
+	}
+	claim := time.NewTicker(claimIdle)
+	defer claim.Stop()
+	log.Printf("[DBWriter] Started - consumer: %s, batch: %d, interval: %v", w.consumer, w.batchSize, w.flushInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			// Unacked entries stay pending and are claimed after a restart
 			log.Println("[DBWriter] Stopped")
 			return
+		case <-claim.C:
+			entries, err := w.queue.Claim(ctx, w.consumer, claimIdle, w.batchSize)
+			if err != nil {
+				log.Printf("[DBWriter] Error claiming pending updates: %v", err)
+				continue
+			}
+			if len(entries) > 0 {
+				log.Printf("[DBWriter] Claimed %d pending updates", len(entries))
+				w.flush(ctx, entries)
+			}
+		default:
+			entries, err := w.queue.Read(ctx, w.consumer, w.batchSize, w.flushInterval)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("[DBWriter] Error reading queue: %v", err)
+					time.Sleep(w.flushInterval)
+				}
+				continue
+			}
+			w.flush(ctx, entries)
 		}
 	}
 }
-func (w *DBWriter) flush(ctx context.Context, batch []models.RatingUpdate) {
-	if len(batch) == 0 {
+
+// flush - Write a batch, ack it only once Postgres has it. Transient failures
+// are retried with backoff, then left pending and claimed again after
+// claimIdle. Rows Postgres rejects are split out and dead-lettered.
+func (w *DBWriter) flush(ctx context.Context, entries []repository.QueuedUpdate) {
+	if len(entries) == 0 {
 		return
 	}
 	start := time.Now()
-	err := w.repo.BatchUpdateRatings(ctx, batch)
-	if err != nil {
-		log.Printf("[DBWriter] Error: %v", err)
-		return
+	ids := make([]string, len(entries))
+	batch := make([]models.RatingUpdate, 0, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+		if e.Update.UserID == 0 {
+			log.Printf("[DBWriter] Dropping undecodable entry %s", e.ID)
+			continue
+		}
+		batch = append(batch, e.Update)
+	}
+	if err := w.write(ctx, batch); err != nil {
+		if repository.IsTransient(err) {
+			log.Printf("[DBWriter] Error, %d updates left pending: %v", len(batch), err)
+			return
+		}
+		log.Printf("[DBWriter] Batch of %d rejected, isolating bad rows: %v", len(batch), err)
+		if err := w.isolate(ctx, batch, err); err != nil {
+			log.Printf("[DBWriter] Error, %d updates left pending: %v", len(batch), err)
+			return
+		}
+	}
+	if err := w.queue.Ack(ctx, ids...); err != nil {
+		// Written but not acked, the replay is skipped by the version guard
+		log.Printf("[DBWriter] Error acking %d updates: %v", len(ids), err)
 	}
 	log.Printf("[DBWriter] Flushed %d updates in %v", len(batch), time.Since(start))
 }
+
+// write - BatchUpdateRatings, retried with exponential backoff while the
+// error is transient
+func (w *DBWriter) write(ctx context.Context, batch []models.RatingUpdate) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := w.repo.BatchUpdateRatings(ctx, batch)
+		if err == nil || !repository.IsTransient(err) || attempt == writeAttempts {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// isolate - Halve a rejected batch until the bad rows are alone, writing the
+// good halves and dead-lettering the bad rows. Returns a transient error if
+// Postgres went away meanwhile; halves already written replay harmlessly.
+func (w *DBWriter) isolate(ctx context.Context, batch []models.RatingUpdate, cause error) error {
+	if len(batch) == 1 {
+		log.Printf("[DBWriter] Dead-lettering update of user %d on board %s: %v", batch[0].UserID, batch[0].BoardID, cause)
+		return w.deadLetters.Add(ctx, batch[0], cause.Error())
+	}
+	mid := len(batch) / 2
+	for _, half := range [][]models.RatingUpdate{batch[:mid], batch[mid:]} {
+		err := w.write(ctx, half)
+		if err == nil {
+			continue
+		}
+		if repository.IsTransient(err) {
+			return err
+		}
+		if err := w.isolate(ctx, half, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
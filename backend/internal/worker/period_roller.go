@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/models"
+	"github.com/stilln0thing/matiks_leaderboard/internal/repository"
+	"github.com/stilln0thing/matiks_leaderboard/internal/service"
+)
+
+// PeriodRoller - Expires time-windowed sets once their window has closed
+// New windows need no setup, UpdateRating creates them on first write and
+// gives them a TTL (repository.WindowTTL). The roller only catches sets that
+// were written without one.
+type PeriodRoller struct {
+	cacheRepo   *repository.CacheRepository
+	leaderboard *service.LeaderboardService
+	interval    time.Duration
+}
+
+func NewPeriodRoller(
+	cacheRepo *repository.CacheRepository,
+	leaderboard *service.LeaderboardService,
+	interval time.Duration,
+) *PeriodRoller {
+	return &PeriodRoller{
+		cacheRepo:   cacheRepo,
+		leaderboard: leaderboard,
+		interval:    interval,
+	}
+}
+
+func (p *PeriodRoller) Start(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	log.Printf("[PeriodRoller] Started - interval: %v", p.interval)
+	// Run once at startup so a window that closed while we were down still expires
+	p.roll(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			p.roll(ctx)
+		case <-ctx.Done():
+			log.Println("[PeriodRoller] Stopped")
+			return
+		}
+	}
+}
+
+func (p *PeriodRoller) roll(ctx context.Context) {
+	boards, err := p.leaderboard.GetBoards(ctx)
+	if err != nil {
+		log.Printf("[PeriodRoller] Error loading boards: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, board := range boards {
+		for _, period := range models.WindowedPeriods {
+			key := repository.PeriodKey(board.ID, period, period.PreviousWindow(now))
+			if err := p.cacheRepo.ExpireWindow(ctx, key, period.Retention()); err != nil {
+				log.Printf("[PeriodRoller] Error expiring %s: %v", key, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/service"
+)
+
+// RatingDecayer - Periodically lowers the ratings of inactive players
+type RatingDecayer struct {
+	leaderboard *service.LeaderboardService
+	inactiveFor time.Duration // No rating update for this long counts as inactive
+	points      int           // Rating lost per inactiveFor
+	floor       int           // Decay never goes below this rating
+	interval    time.Duration
+}
+
+func NewRatingDecayer(
+	leaderboard *service.LeaderboardService,
+	inactiveFor time.Duration,
+	points, floor int,
+	interval time.Duration,
+) *RatingDecayer {
+	return &RatingDecayer{
+		leaderboard: leaderboard,
+		inactiveFor: inactiveFor,
+		points:      points,
+		floor:       floor,
+		interval:    interval,
+	}
+}
+
+func (d *RatingDecayer) Start(ctx context.Context) {
+	if d.points <= 0 || d.inactiveFor <= 0 {
+		log.Println("[RatingDecayer] Disabled")
+		return
+	}
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	log.Printf("[RatingDecayer] Started - %d points after %v inactive, floor %d, interval: %v",
+		d.points, d.inactiveFor, d.floor, d.interval)
+	for {
+		select {
+		case <-ticker.C:
+			d.decay(ctx)
+		case <-ctx.Done():
+			log.Println("[RatingDecayer] Stopped")
+			return
+		}
+	}
+}
+
+func (d *RatingDecayer) decay(ctx context.Context) {
+	boards, err := d.leaderboard.GetBoards(ctx)
+	if err != nil {
+		log.Printf("[RatingDecayer] Error loading boards: %v", err)
+		return
+	}
+	for _, board := range boards {
+		n, err := d.leaderboard.DecayInactive(ctx, board.ID, d.inactiveFor, d.points, d.floor)
+		if err != nil {
+			log.Printf("[RatingDecayer] Error decaying board %s: %v", board.ID, err)
+		}
+		if n > 0 {
+			log.Printf("[RatingDecayer] Decayed %d players on board %s", n, board.ID)
+		}
+	}
+}
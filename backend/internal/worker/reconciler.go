@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/service"
+)
+
+// Reconciler - Periodically compares Redis and Postgres and repairs drift
+type Reconciler struct {
+	reconcile *service.ReconcileService
+	interval  time.Duration
+}
+
+func NewReconciler(reconcile *service.ReconcileService, interval time.Duration) *Reconciler {
+	return &Reconciler{reconcile: reconcile, interval: interval}
+}
+
+func (rc *Reconciler) Start(ctx context.Context) {
+	if rc.interval <= 0 {
+		log.Println("[Reconciler] Disabled")
+		return
+	}
+	ticker := time.NewTicker(rc.interval)
+	defer ticker.Stop()
+	log.Printf("[Reconciler] Started - interval: %v", rc.interval)
+	for {
+		select {
+		case <-ticker.C:
+			// A manual run may still be going, skip this round
+			if _, err := rc.reconcile.Run(ctx); errors.Is(err, service.ErrReconcileRunning) {
+				log.Println("[Reconciler] Previous run still going, skipped")
+			}
+		case <-ctx.Done():
+			log.Println("[Reconciler] Stopped")
+			return
+		}
+	}
+}
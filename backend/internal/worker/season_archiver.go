@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/service"
+)
+
+// SeasonArchiver - Resumes season archive runs cut short by a restart, once
+// their lease has run out
+type SeasonArchiver struct {
+	seasons  *service.SeasonService
+	interval time.Duration
+}
+
+func NewSeasonArchiver(seasons *service.SeasonService, interval time.Duration) *SeasonArchiver {
+	return &SeasonArchiver{seasons: seasons, interval: interval}
+}
+
+func (a *SeasonArchiver) Start(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	log.Printf("[SeasonArchiver] Started - interval: %v", a.interval)
+	// Run once at startup, a run this instance was doing may be abandoned
+	a.resume(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			a.resume(ctx)
+		case <-ctx.Done():
+			log.Println("[SeasonArchiver] Stopped")
+			return
+		}
+	}
+}
+
+func (a *SeasonArchiver) resume(ctx context.Context) {
+	if err := a.seasons.ResumeArchiving(ctx); err != nil {
+		log.Printf("[SeasonArchiver] Error: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/stilln0thing/matiks_leaderboard/internal/service"
+)
+
+// Snapshotter - Takes periodic compact snapshots of every board in Postgres
+// so historical queries only replay a bounded slice of rating_history
+type Snapshotter struct {
+	history     *service.HistoryService
+	leaderboard *service.LeaderboardService
+	every       time.Duration // Age of the newest snapshot before a new one is taken
+	retention   time.Duration
+	interval    time.Duration
+}
+
+func NewSnapshotter(
+	history *service.HistoryService,
+	leaderboard *service.LeaderboardService,
+	every, retention, interval time.Duration,
+) *Snapshotter {
+	return &Snapshotter{
+		history:     history,
+		leaderboard: leaderboard,
+		every:       every,
+		retention:   retention,
+		interval:    interval,
+	}
+}
+
+func (s *Snapshotter) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	log.Printf("[Snapshotter] Started - every: %v, retention: %v", s.every, s.retention)
+	// Run once at startup, a snapshot may have come due while we were down
+	s.snapshot(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			s.snapshot(ctx)
+		case <-ctx.Done():
+			log.Println("[Snapshotter] Stopped")
+			return
+		}
+	}
+}
+
+func (s *Snapshotter) snapshot(ctx context.Context) {
+	boards, err := s.leaderboard.GetBoards(ctx)
+	if err != nil {
+		log.Printf("[Snapshotter] Error loading boards: %v", err)
+		return
+	}
+	for _, board := range boards {
+		start := time.Now()
+		snapshot, err := s.history.TakeSnapshot(ctx, board.ID, s.every)
+		if err != nil {
+			log.Printf("[Snapshotter] Error snapshotting board %s: %v", board.ID, err)
+			continue
+		}
+		if snapshot != nil {
+			log.Printf("[Snapshotter] Snapshot %d of board %s in %v", snapshot.ID, board.ID, time.Since(start))
+		}
+	}
+	if n, err := s.history.PruneSnapshots(ctx, s.retention); err != nil {
+		log.Printf("[Snapshotter] Error pruning snapshots: %v", err)
+	} else if n > 0 {
+		log.Printf("[Snapshotter] Pruned %d snapshots", n)
+	}
+}